@@ -2,24 +2,37 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
 	"path"
 
 	"github.com/seibert-media/jigquery"
+	"github.com/seibert-media/jigquery/function"
 
 	"github.com/seibert-media/golibs/log"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+
+	// register the sqlite3 driver for the sql sink, which the function does not link as it requires cgo
+	_ "github.com/mattn/go-sqlite3"
 )
 
 var (
-	mode          = flag.String("mode", "", "the mode to run in [generate, deploy, schema]")
+	mode          = flag.String("mode", "", "the mode to run in [generate, deploy, schema, reprocess, serve]")
 	help          = flag.Bool("help", false, "show this usage info")
 	debug         = flag.Bool("debug", false, "print debug logging")
 	googleProject = flag.String("googleProject", os.Getenv("GOOGLE_CLOUD_PROJECT"), "the google cloud project to use")
 	interactive   = flag.Bool("i", false, "run in interactive mode")
+	dryRun        = flag.Bool("dryRun", false, "print the extracted rows and the table DDL instead of writing them")
+	dryRunFormat  = flag.String("dryRunFormat", "table", "the format to print rows in during a dry run [table, ndjson]")
+	sync          = flag.String("sync", "issues", "what to synchronize [issues, reconcile, worklogs, comments, agile, metadata, backfill, reprocess]")
+	jql           = flag.String("jql", "", "replaces the query of an issues run, without moving it's checkpoint")
+	fullResync    = flag.Bool("fullResync", false, "fetch all issues in an issues run, ignoring the last checkpoint")
+	since         = flag.String("since", "", "the start of a backfill or an issues run, e.g. 2019-01-01")
+	until         = flag.String("until", "", "the end of a backfill or an issues run, now by default")
+	window        = flag.String("window", "", "the windows a backfill is split into [month, week, day], month by default")
 )
 
 func main() {
@@ -62,15 +75,52 @@ func main() {
 			if _, err := uploadSchema(ctx); err != nil {
 				log.From(ctx).Fatal("deploying", zap.Error(err))
 			}
+		case "reprocess":
+			if err := Reprocess(ctx); err != nil {
+				log.From(ctx).Fatal("reprocessing", zap.Error(err))
+			}
+		case "serve":
+			if err := Serve(ctx); err != nil {
+				log.From(ctx).Fatal("serving", zap.Error(err))
+			}
 		default:
 			fmt.Printf("%s\n 	-mode generate 	// Generate .env and .env.yaml files from the Jira auth.json under the provided path\n", path.Base(os.Args[0]))
 			fmt.Printf("	-mode deploy 	// deploy the function and it's related resources\n")
 			fmt.Printf("	-mode schema 	// update the schema\n")
+			fmt.Printf("	-mode reprocess // extract the archived issues again using the local -schemaFile\n")
+			fmt.Printf("	-mode serve 	// run the syncs on their schedules in a long-running process\n")
 		}
 		os.Exit(0)
 	}
 
-	if err := jigquery.InsertIssues(ctx, jigquery.PubSubMessage{}); err != nil {
+	opts, err := json.Marshal(function.RunOptions{
+		DryRun: *dryRun, Format: *dryRunFormat, Sync: *sync,
+		JQL: *jql, FullResync: *fullResync,
+		Since: *since, Until: *until, Window: *window,
+	})
+	if err != nil {
+		log.From(ctx).Fatal("encoding run options", zap.Error(err))
+	}
+
+	if err := jigquery.InsertIssues(ctx, jigquery.PubSubMessage{Data: opts}); err != nil {
 		os.Exit(1)
 	}
 }
+
+// Reprocess the archive configured by the environment with the local -schemaFile
+// If -bigqueryTable is set, the rows are written into that table instead, e.g. to rebuild the table next to the current one
+func Reprocess(ctx context.Context) error {
+	env := function.ParseEnvironment()
+	env.SchemaBucket = ""
+	env.SchemaPath = *schemaFile
+	if len(*bigQueryTable) > 0 {
+		env.BigQueryTable = *bigQueryTable
+		env.SinkTable = *bigQueryTable
+	}
+
+	if err := env.Validate(); err != nil {
+		return err
+	}
+
+	return function.Run(ctx, env, function.RunOptions{DryRun: *dryRun, Format: *dryRunFormat, Sync: function.ReprocessSync})
+}
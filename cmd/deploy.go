@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -19,6 +20,7 @@ import (
 	"cloud.google.com/go/storage"
 	"github.com/pkg/errors"
 	"github.com/seibert-media/golibs/log"
+	"github.com/seibert-media/jigquery/function"
 	"go.uber.org/zap"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/cloudfunctions/v1"
@@ -30,11 +32,40 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+// functionTimeout after which runs of the function get terminated, runs reaching it continue in a follow-up run
+const functionTimeout = "540s"
+
 var (
 	jiraProject     = flag.String("jiraProject", "", "the jira project to use")
 	schemaFile      = flag.String("schemaFile", "./.schema.json", "the json file containing the schema")
 	bigQueryDataset = flag.String("bigqueryDataset", "", "the dataset to use")
 	bigQueryTable   = flag.String("bigqueryTable", "", "the table to store issues in")
+	bigQueryMode    = flag.String("bigqueryMode", "append", "how issues are written to the table [append, merge, snapshot]")
+	bigQueryKey     = flag.String("bigqueryKey", "", "the schema field identifying an issue, required for -bigqueryMode merge")
+	bigQueryHistory = flag.Bool("bigqueryHistory", false, "keep an append-only history table next to the merged table")
+	bigQueryInsert  = flag.String("bigqueryInsert", "stream", "how rows are sent to bigquery [stream, load]")
+	archive         = flag.String("archive", "", "where to store the raw json of fetched issues for reprocessing [gs://bucket/prefix]")
+	checkpoint      = flag.String("checkpoint", "bigquery", "where to store the last run [bigquery, gs://bucket/path, firestore://project/collection/document]")
+	schedule        = flag.String("schedule", "0 0 * * *", "the schedule for syncing the issues updated since the last run")
+	reconcile       = flag.String("reconcileSchedule", "", "the schedule for removing deleted issues from the table, e.g. `0 3 * * 0`, requires -bigqueryKey")
+	links           = flag.Bool("links", false, "write the links, subtasks and epics of issues into the <table>_links table")
+	epicLinkField   = flag.String("epicLinkField", "", "the id of the Epic Link custom field, e.g. customfield_10008")
+	sprintField     = flag.String("sprintField", "", "the id of the Sprint custom field, e.g. customfield_10010, whose legacy sprint strings get parsed")
+	users           = flag.Bool("users", false, "write the users referenced by issues into the <table>_users table")
+	userPolicy      = flag.String("userPolicy", "keep", "how user fields are stored [keep, hash, drop]")
+	userSalt        = flag.String("userSalt", "", "the salt used to hash users, required for -userPolicy hash and drop, stored encrypted like the jira auth")
+	privacyKey      = flag.String("privacyKey", "", "the key used to hash and tokenize schema fields with a privacy option, stored encrypted like the jira auth")
+	worklogs        = flag.String("worklogSchedule", "", "the schedule for syncing worklogs into the <table>_worklogs table, e.g. `0 1 * * *`")
+	comments        = flag.String("commentSchedule", "", "the schedule for syncing comments into the <table>_comments table, e.g. `0 1 * * *`")
+	metadata        = flag.String("metadataSchedule", "", "the schedule for syncing the project's statuses, issue types, priorities, resolutions, components and versions")
+	httpTrigger     = flag.Bool("http", false, "also deploy the function <name>--http, which runs syncs on authenticated POST requests and responds with their summary")
+	runOptions      = flag.String("runOptions", "{}", "the json run options sent by the scheduler job of the issues runs, e.g. `{\"fullResync\": true}` for daily full syncs")
+	pushgateway     = flag.String("pushgateway", "", "the url of the prometheus pushgateway the metrics of each run are pushed to")
+	notifyWebhook   = flag.String("notifyWebhook", "", "the incoming webhook url notifications about runs are posted to")
+	notifyFormat    = flag.String("notifyFormat", "webhook", "the format of notifications [webhook, slack, googlechat, teams]")
+	notifyOn        = flag.String("notifyOn", "failure", "the runs to notify about, comma separated [failure, success]")
+	notifyEmptyRuns = flag.Int("notifyEmptyRuns", 0, "notify once this many consecutive issues runs inserted no rows, 0 disables it")
+	agile           = flag.String("agileSchedule", "", "the schedule for syncing boards and sprints into the <table>_boards, <table>_sprints and <table>_sprint_issues tables")
 )
 
 // Deploy the function
@@ -71,6 +102,15 @@ func Deploy(ctx context.Context, project string) error {
 	if err := validateFlags(); err != nil {
 		return err
 	}
+	if len(*archive) > 0 {
+		fields, err := function.GetSchema(ctx, "", *schemaFile)
+		if err != nil {
+			return errors.Wrap(err, "reading -schemaFile")
+		}
+		if err := function.ValidateArchive(*archive, fields); err != nil {
+			return errors.Wrap(err, "invalid -archive")
+		}
+	}
 
 	var auth JiraAuth
 	authFile, err := os.OpenFile("./.auth.json", os.O_RDONLY, os.ModePerm)
@@ -95,6 +135,26 @@ func Deploy(ctx context.Context, project string) error {
 		}
 	}
 
+	var privacySecret string
+	if len(*privacyKey) > 0 {
+		log.From(ctx).Debug("encoding privacy key")
+		privacySecret, err = function.EncodePrivacyKey(ctx, auth.Resource, *privacyKey)
+		if err != nil {
+			log.From(ctx).Error("encoding privacy key", zap.Error(err))
+			return err
+		}
+	}
+
+	var userSaltSecret string
+	if len(*userSalt) > 0 {
+		log.From(ctx).Debug("encoding user salt")
+		userSaltSecret, err = function.EncodeUserSalt(ctx, auth.Resource, *userSalt)
+		if err != nil {
+			log.From(ctx).Error("encoding user salt", zap.Error(err))
+			return err
+		}
+	}
+
 	schemaPath, err := uploadSchema(ctx)
 	if err != nil {
 		return err
@@ -138,11 +198,11 @@ func Deploy(ctx context.Context, project string) error {
 		Parent: location,
 		Job: &schedulerpb.Job{
 			Name:     fmt.Sprintf("%s/jobs/%s", location, functionName),
-			Schedule: "0 0 * * *",
+			Schedule: *schedule,
 			Target: &schedulerpb.Job_PubsubTarget{
 				PubsubTarget: &schedulerpb.PubsubTarget{
 					TopicName: topic,
-					Data:      []byte("{}"),
+					Data:      []byte(*runOptions),
 				},
 			},
 		},
@@ -151,6 +211,36 @@ func Deploy(ctx context.Context, project string) error {
 		return err
 	}
 
+	for sync, schedule := range map[string]string{
+		"reconcile": *reconcile,
+		"worklogs":  *worklogs,
+		"comments":  *comments,
+		"agile":     *agile,
+		"metadata":  *metadata,
+	} {
+		if len(schedule) < 1 {
+			continue
+		}
+
+		log.From(ctx).Debug("creating scheduler job", zap.String("sync", sync))
+		if _, err := sched.CreateJob(ctx, &schedulerpb.CreateJobRequest{
+			Parent: location,
+			Job: &schedulerpb.Job{
+				Name:     fmt.Sprintf("%s/jobs/%s--%s", location, functionName, sync),
+				Schedule: schedule,
+				Target: &schedulerpb.Job_PubsubTarget{
+					PubsubTarget: &schedulerpb.PubsubTarget{
+						TopicName: topic,
+						Data:      []byte(fmt.Sprintf(`{"sync":%q}`, sync)),
+					},
+				},
+			},
+		}); err != nil && !isExists(err) {
+			log.From(ctx).Error("creating scheduler job", zap.String("sync", sync), zap.Error(err))
+			return err
+		}
+	}
+
 	log.From(ctx).Debug("creating service account")
 	serviceAccount, err := CreateServiceAccount(ctx, project)
 	if err != nil {
@@ -166,22 +256,77 @@ func Deploy(ctx context.Context, project string) error {
 		},
 		EntryPoint:          "InsertIssues",
 		MaxInstances:        1,
-		Timeout:             "540s",
+		Timeout:             functionTimeout,
 		ServiceAccountEmail: serviceAccount,
 		SourceUploadUrl:     uploadURL.UploadUrl,
 		EnvironmentVariables: map[string]string{
-			"JIRA_AUTH_RESOURCE": auth.Resource,
-			"JIRA_AUTH_SECRET":   auth.Secret,
-			"JIRA_PROJECT":       *jiraProject,
-			"SCHEMA_BUCKET":      *googleProject,
-			"SCHEMA_PATH":        schemaPath,
-			"BIGQUERY_PROJECT":   *googleProject,
-			"BIGQUERY_DATASET":   *bigQueryDataset,
-			"BIGQUERY_TABLE":     *bigQueryTable,
+			"JIRA_AUTH_RESOURCE":   auth.Resource,
+			"JIRA_AUTH_SECRET":     auth.Secret,
+			"JIRA_PROJECT":         *jiraProject,
+			"SCHEMA_BUCKET":        *googleProject,
+			"SCHEMA_PATH":          schemaPath,
+			"BIGQUERY_PROJECT":     *googleProject,
+			"BIGQUERY_DATASET":     *bigQueryDataset,
+			"BIGQUERY_TABLE":       *bigQueryTable,
+			"BIGQUERY_MODE":        *bigQueryMode,
+			"BIGQUERY_KEY":         *bigQueryKey,
+			"BIGQUERY_HISTORY":     strconv.FormatBool(*bigQueryHistory),
+			"BIGQUERY_INSERT_MODE": *bigQueryInsert,
+			"CHECKPOINT":           *checkpoint,
+			"ARCHIVE":              *archive,
+			"SYNC_LINKS":           strconv.FormatBool(*links),
+			"JIRA_EPIC_LINK_FIELD": *epicLinkField,
+			"JIRA_SPRINT_FIELD":    *sprintField,
+			"SYNC_USERS":           strconv.FormatBool(*users),
+			"USER_POLICY":          *userPolicy,
+			"USER_SALT_RESOURCE":   auth.Resource,
+			"USER_SALT":            userSaltSecret,
+			"PRIVACY_KEY_RESOURCE": auth.Resource,
+			"PRIVACY_KEY_SECRET":   privacySecret,
+			"PUBSUB_TOPIC":         topic,
+			"RUN_TIMEOUT":          functionTimeout,
+			"METRICS_PUSHGATEWAY":  *pushgateway,
+			"NOTIFY_WEBHOOK":       *notifyWebhook,
+			"NOTIFY_FORMAT":        *notifyFormat,
+			"NOTIFY_ON":            *notifyOn,
+			"NOTIFY_EMPTY_RUNS":    strconv.Itoa(*notifyEmptyRuns),
 		},
 	}
 
 	log.From(ctx).Info("deploying")
+	if err := deployFunction(ctx, svc, location, function); err != nil {
+		return err
+	}
+
+	if *httpTrigger {
+		// the http function shares the environment, it only differs in it's trigger and entry point
+		httpFunction := *function
+		httpFunction.Name = fmt.Sprintf("%s/functions/%s--http", location, functionName)
+		httpFunction.EventTrigger = nil
+		httpFunction.HttpsTrigger = &cloudfunctions.HttpsTrigger{}
+		httpFunction.EntryPoint = "RunIssues"
+
+		log.From(ctx).Info("deploying http function")
+		if err := deployFunction(ctx, svc, location, &httpFunction); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf(`
+Function: %s
+
+Status:	https://console.cloud.google.com/functions/list?project=%s
+Logs:	https://console.cloud.google.com/logs/viewer?project=%s&resource=cloud_function%%2Ffunction_name%%2F%s
+Scheduler: https://console.cloud.google.com/cloudscheduler?project=%s
+`, functionName, project, project, functionName, project)
+
+	return nil
+}
+
+// deployFunction by creating it, or by updating it if it already exists, and wait for the deployment to finish
+func deployFunction(ctx context.Context, svc *cloudfunctions.Service, location string, function *cloudfunctions.CloudFunction) error {
+	fnc := cloudfunctions.NewProjectsLocationsFunctionsService(svc)
+
 	created, err := fnc.Create(location, function).Context(ctx).Do()
 	exists := isExists(err)
 	if err != nil && !exists {
@@ -189,7 +334,7 @@ func Deploy(ctx context.Context, project string) error {
 	}
 
 	if exists {
-		created, err = fnc.Patch(fmt.Sprintf("%s/functions/%s", location, functionName), function).Context(ctx).Do()
+		created, err = fnc.Patch(function.Name, function).Context(ctx).Do()
 		if err != nil {
 			return err
 		}
@@ -204,14 +349,6 @@ func Deploy(ctx context.Context, project string) error {
 		}
 	}
 
-	fmt.Printf(`
-Function: %s
-
-Status:	https://console.cloud.google.com/functions/list?project=%s
-Logs:	https://console.cloud.google.com/logs/viewer?project=%s&resource=cloud_function%%2Ffunction_name%%2F%s
-Scheduler: https://console.cloud.google.com/cloudscheduler?project=%s
-`, functionName, project, project, functionName, project)
-
 	return nil
 }
 
@@ -225,6 +362,21 @@ func validateFlags() error {
 	if len(*bigQueryTable) < 1 {
 		return errors.New("missing -bigqueryTable")
 	}
+	if *bigQueryMode == "merge" && len(*bigQueryKey) < 1 {
+		return errors.New("missing -bigqueryKey")
+	}
+	if len(*reconcile) > 0 && len(*bigQueryKey) < 1 {
+		return errors.New("missing -bigqueryKey")
+	}
+	if _, err := function.ParseRunOptions([]byte(*runOptions)); err != nil {
+		return errors.Wrap(err, "invalid -runOptions")
+	}
+	if *userPolicy != "keep" && len(*userSalt) < 1 {
+		return errors.New("missing -userSalt")
+	}
+	if *userPolicy != "keep" && len(*archive) > 0 {
+		return errors.New("-archive can not be combined with -userPolicy hash or drop")
+	}
 	return nil
 }
 
@@ -386,6 +538,10 @@ func CreateServiceAccount(ctx context.Context, project string) (string, error) {
 			Members: []string{fmt.Sprintf("serviceAccount:%s", mail)},
 			Role:    "roles/cloudfunctions.serviceAgent",
 		},
+		{
+			Members: []string{fmt.Sprintf("serviceAccount:%s", mail)},
+			Role:    "roles/pubsub.publisher",
+		},
 	}
 
 	policy.Bindings = append(policy.Bindings, bindings...)
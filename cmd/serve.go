@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/seibert-media/golibs/log"
+	"github.com/seibert-media/jigquery/function"
+	"go.uber.org/zap"
+)
+
+// shutdownTimeout for the requests in progress once the daemon stopped
+const shutdownTimeout = 10 * time.Second
+
+var (
+	listen             = flag.String("listen", ":8080", "the address serving /healthz, /readyz and /metrics in -mode serve")
+	runShutdownTimeout = flag.Duration("runShutdownTimeout", 20*time.Second, "how long the current run may take to write it's last page once -mode serve stops, before it gets canceled")
+)
+
+// Serve runs the syncs on their schedules in a long-running process configured by the environment, e.g. in a container
+// The issues are synced on -schedule with -runOptions, the other syncs on their schedule flags if set
+// On SIGINT or SIGTERM it stops scheduling, lets the current run write it's last page within -runShutdownTimeout and shuts the server down
+func Serve(ctx context.Context) error {
+	env := function.ParseEnvironment()
+	if err := env.Validate(); err != nil {
+		return err
+	}
+
+	jobs, err := serveJobs()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	daemon := &function.Daemon{Env: env, Jobs: jobs, ShutdownTimeout: *runShutdownTimeout}
+	server := &http.Server{Addr: *listen, Handler: daemon.Handler()}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.From(ctx).Info("serving", zap.String("address", *listen))
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.From(ctx).Error("serving", zap.Error(err))
+			serveErr <- err
+			cancel()
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case sig := <-signals:
+			log.From(ctx).Info("stopping, waiting for the current run to write it's last page", zap.String("signal", sig.String()), zap.Duration("timeout", *runShutdownTimeout))
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	runErr := daemon.Run(ctx)
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.From(ctx).Error("shutting down", zap.Error(err))
+	}
+
+	select {
+	case err := <-serveErr:
+		return err
+	default:
+		return runErr
+	}
+}
+
+// serveJobs from the schedule flags, syncs without a schedule are skipped
+func serveJobs() ([]function.Job, error) {
+	opts, err := function.ParseRunOptions([]byte(*runOptions))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid -runOptions")
+	}
+
+	var jobs []function.Job
+	for _, job := range []struct {
+		flag, schedule string
+		opts           function.RunOptions
+	}{
+		{"schedule", *schedule, opts},
+		{"reconcileSchedule", *reconcile, function.RunOptions{Sync: function.ReconcileSync}},
+		{"worklogSchedule", *worklogs, function.RunOptions{Sync: function.WorklogsSync}},
+		{"commentSchedule", *comments, function.RunOptions{Sync: function.CommentsSync}},
+		{"agileSchedule", *agile, function.RunOptions{Sync: function.AgileSync}},
+		{"metadataSchedule", *metadata, function.RunOptions{Sync: function.MetadataSync}},
+	} {
+		if len(job.schedule) < 1 {
+			continue
+		}
+
+		schedule, err := function.ParseSchedule(job.schedule)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid -%s", job.flag)
+		}
+		jobs = append(jobs, function.Job{Schedule: schedule, Options: job.opts})
+	}
+
+	return jobs, nil
+}
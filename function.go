@@ -2,6 +2,7 @@ package jigquery
 
 import (
 	"context"
+	"net/http"
 	"os"
 
 	"github.com/seibert-media/jigquery/function"
@@ -39,6 +40,7 @@ type PubSubMessage struct {
 }
 
 // InsertIssues into BigQuery
+// The message data may contain JSON encoded function.RunOptions for this run
 func InsertIssues(ctx context.Context, m PubSubMessage) error {
 	ctx = log.WithLogger(ctx, logger)
 
@@ -48,9 +50,22 @@ func InsertIssues(ctx context.Context, m PubSubMessage) error {
 		return err
 	}
 
-	if err := function.InsertIssues(ctx, env); err != nil {
+	opts, err := function.ParseRunOptions(m.Data)
+	if err != nil {
+		log.From(ctx).Error("parsing run options", zap.Error(err))
+		return err
+	}
+
+	if _, err := function.RunSummary(ctx, env, opts); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// RunIssues over HTTP, the body of the POST request may contain JSON encoded function.RunOptions
+// The response contains the JSON encoded function.Summary of the run
+func RunIssues(w http.ResponseWriter, r *http.Request) {
+	ctx := log.WithLogger(r.Context(), logger)
+	function.RunHandler(env).ServeHTTP(w, r.WithContext(ctx))
+}
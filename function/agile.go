@@ -0,0 +1,311 @@
+package function
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seibert-media/golibs/log"
+	"go.uber.org/zap"
+)
+
+// boardSchema of the `<table>_boards` table
+var boardSchema = []FieldSchema{
+	FieldSchema{Name: "id", Type: "INTEGER", Path: "id", Required: true},
+	FieldSchema{Name: "name", Type: "STRING", Path: "name"},
+	FieldSchema{Name: "type", Type: "STRING", Path: "type"},
+	FieldSchema{Name: "project", Type: "STRING", Path: "location.projectKey"},
+}
+
+// sprintSchema of the `<table>_sprints` table
+var sprintSchema = []FieldSchema{
+	FieldSchema{Name: "id", Type: "INTEGER", Path: "id", Required: true},
+	FieldSchema{Name: "board", Type: "INTEGER", Path: "originBoardId"},
+	FieldSchema{Name: "name", Type: "STRING", Path: "name"},
+	FieldSchema{Name: "state", Type: "STRING", Path: "state"},
+	FieldSchema{Name: "goal", Type: "STRING", Path: "goal"},
+	FieldSchema{Name: "startDate", Type: "TIMESTAMP", Path: "startDate"},
+	FieldSchema{Name: "endDate", Type: "TIMESTAMP", Path: "endDate"},
+	FieldSchema{Name: "completeDate", Type: "TIMESTAMP", Path: "completeDate"},
+}
+
+// sprintIssueSchema of the `<table>_sprint_issues` table, which contains a row per issue and sprint
+var sprintIssueSchema = []FieldSchema{
+	FieldSchema{Name: "id", Type: "STRING", Path: "id", Required: true},
+	FieldSchema{Name: "sprint", Type: "INTEGER", Path: "sprint", Required: true},
+	FieldSchema{Name: "issue", Type: "STRING", Path: "issue", Required: true},
+}
+
+// SyncAgile replaces the boards of the project, their sprints and the sprint's issues
+// in the `<table>_boards`, `<table>_sprints` and `<table>_sprint_issues` tables
+// The run is recorded in the executions of the issues table
+// In a dry run, the rows are printed to stdout instead and nothing gets created, written or recorded
+func SyncAgile(ctx context.Context, env Environment, opts RunOptions) (err error) {
+	exec := Execution{Timestamp: time.Now().UTC(), Version: env.Version, Sync: AgileSync}
+
+	sink, err := openRecorder(ctx, env, opts, AgileSync)
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+	defer recordExecution(ctx, sink, &exec, &err)
+
+	log.From(ctx).Debug("creating jira client")
+	jira, err := NewJiraClient(ctx, env)
+	if err != nil {
+		log.From(ctx).Error("creating jira client", zap.Error(err))
+		return err
+	}
+
+	log.From(ctx).Info("fetching boards")
+	boards, err := jira.Boards(ctx)
+	if err != nil {
+		log.From(ctx).Error("fetching boards", zap.Error(err))
+		return err
+	}
+
+	var sprints, memberships []Issue
+	seen := make(map[string]bool)
+	for _, board := range boards {
+		// only scrum boards support sprints, the api responds with an error for all others
+		if board["type"] != "scrum" {
+			continue
+		}
+
+		log.From(ctx).Info("fetching sprints", zap.Any("board", board["id"]))
+		boardSprints, err := jira.Sprints(ctx, board["id"])
+		if err != nil {
+			log.From(ctx).Error("fetching sprints", zap.Any("board", board["id"]), zap.Error(err))
+			return err
+		}
+
+		for _, sprint := range boardSprints {
+			// sprints can be shared between boards
+			id := fmt.Sprint(sprint["id"])
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			sprints = append(sprints, sprint)
+
+			log.From(ctx).Debug("fetching sprint issues", zap.String("sprint", id))
+			issues, err := jira.SprintIssues(ctx, sprint["id"])
+			if err != nil {
+				log.From(ctx).Error("fetching sprint issues", zap.String("sprint", id), zap.Error(err))
+				return err
+			}
+
+			for _, issue := range issues {
+				memberships = append(memberships, Issue{
+					"id":     fmt.Sprintf("%s-%v", id, issue["key"]),
+					"sprint": sprint["id"],
+					"issue":  issue["key"],
+				})
+			}
+		}
+	}
+
+	for _, table := range []struct {
+		suffix string
+		schema []FieldSchema
+		rows   []Issue
+	}{
+		{"boards", boardSchema, boards},
+		{"sprints", sprintSchema, sprints},
+		{"sprint_issues", sprintIssueSchema, memberships},
+	} {
+		if err := replaceTable(ctx, env.dimension(table.suffix, "id"), opts, table.schema, table.rows, &exec); err != nil {
+			log.From(ctx).Error("writing table", zap.String("table", table.suffix), zap.Error(err))
+			return err
+		}
+	}
+
+	log.From(ctx).Info("inserted", zap.Int("boards", len(boards)), zap.Int("sprints", len(sprints)), zap.Int("memberships", len(memberships)))
+	return nil
+}
+
+// replaceTable writes the rows extracted from the Jira objects into the dimension table of env
+// Rows that are no longer part of objects get removed, if the sink supports it
+func replaceTable(ctx context.Context, env Environment, opts RunOptions, schema []FieldSchema, objects []Issue, exec *Execution) error {
+	sink, err := openTable(ctx, env, opts)
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+
+	if err := sink.Prepare(ctx, schema); err != nil {
+		return err
+	}
+
+	rows := make([]Issue, len(objects))
+	for i, object := range objects {
+		if rows[i], err = FieldExtractor(schema).extractRow(object); err != nil {
+			return err
+		}
+	}
+
+	inserted, err := sink.Write(ctx, rows)
+	exec.Fetched += len(rows)
+	exec.Inserted += inserted
+	exec.Rejected += rejectedRows(len(rows), inserted, err)
+	if err != nil {
+		return err
+	}
+
+	reconciler, ok := sink.(Reconciler)
+	if !ok {
+		return nil
+	}
+
+	stored, err := reconciler.Keys(ctx)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := reconciler.Delete(ctx, missingKeys(stored, rows, "id"), exec.Timestamp)
+	exec.Deleted += deleted
+	return err
+}
+
+// Boards of the client's project
+func (c JiraClient) Boards(ctx context.Context) ([]Issue, error) {
+	return c.agile(ctx, fmt.Sprintf("rest/agile/1.0/board?projectKeyOrId=%s", url.QueryEscape(c.Project)))
+}
+
+// Sprints of the board with the provided id
+func (c JiraClient) Sprints(ctx context.Context, board interface{}) ([]Issue, error) {
+	return c.agile(ctx, fmt.Sprintf("rest/agile/1.0/board/%v/sprint", board))
+}
+
+// SprintIssues of the sprint with the provided id, only containing their id and key
+func (c JiraClient) SprintIssues(ctx context.Context, sprint interface{}) ([]Issue, error) {
+	return c.agile(ctx, fmt.Sprintf("rest/agile/1.0/sprint/%v/issue?fields=key", sprint))
+}
+
+type agilePage struct {
+	StartAt    int     `json:"startAt"`
+	MaxResults int     `json:"maxResults"`
+	Total      int     `json:"total"`
+	IsLast     bool    `json:"isLast"`
+	Values     []Issue `json:"values"`
+	Issues     []Issue `json:"issues"`
+}
+
+// agile reads all pages of a list from the agile api
+// Lists of boards and sprints contain their values and signal their last page, lists of issues have a total instead
+func (c JiraClient) agile(ctx context.Context, path string) ([]Issue, error) {
+	values := []Issue{}
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+
+	for {
+		log.From(ctx).Debug("reading page", zap.String("path", path), zap.Int("startAt", len(values)))
+
+		req, err := c.NewRequest("GET", fmt.Sprintf("%s%sstartAt=%d", path, separator, len(values)), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var page agilePage
+		resp, err := c.Do(req, &page)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("reading %s: status %v", path, resp.StatusCode)
+		}
+
+		received := append(page.Values, page.Issues...)
+		values = append(values, received...)
+
+		if page.IsLast || len(received) < 1 || (page.Total > 0 && len(values) >= page.Total) {
+			return values, nil
+		}
+	}
+}
+
+// legacySprintPrefix starts the string representation of sprints returned by older Jira versions
+const legacySprintPrefix = "com.atlassian.greenhopper.service.sprint.Sprint@"
+
+// legacySprintAttribute matches the start of an attribute within a legacy sprint string
+// Names and goals may contain commas, so only known attributes are used to split the string
+var legacySprintAttribute = regexp.MustCompile(`(?:\[|,)(id|rapidViewId|state|name|goal|startDate|endDate|completeDate|activatedDate|sequence)=`)
+
+// parseSprintField replaces the legacy sprint strings in the sprint custom field of the issues with their structured representation,
+// so the sprints can be traversed like the ones returned by newer Jira versions
+func parseSprintField(issues []Issue, field string) {
+	if len(field) < 1 {
+		return
+	}
+
+	for _, issue := range issues {
+		if fields, ok := issue["fields"].(map[string]interface{}); ok && fields[field] != nil {
+			fields[field] = parseLegacySprints(fields[field])
+		}
+	}
+}
+
+// parseLegacySprints replaces the legacy sprint strings in value with their structured representation
+// Values that are neither a legacy sprint string nor a list of them are returned unchanged
+func parseLegacySprints(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if sprint, ok := parseLegacySprint(v); ok {
+			return sprint
+		}
+	case []interface{}:
+		parsed := make([]interface{}, len(v))
+		for i, element := range v {
+			parsed[i] = parseLegacySprints(element)
+		}
+		return parsed
+	}
+
+	return value
+}
+
+// parseLegacySprint like `com.atlassian.greenhopper.service.sprint.Sprint@1a2b[id=1,rapidViewId=2,state=CLOSED,name=Sprint 1,...]`
+// Numeric attributes are converted to numbers and `<null>` to nil, all others are kept as string
+func parseLegacySprint(value string) (map[string]interface{}, bool) {
+	if !strings.HasPrefix(value, legacySprintPrefix) || !strings.HasSuffix(value, "]") {
+		return nil, false
+	}
+
+	matches := legacySprintAttribute.FindAllStringSubmatchIndex(value, -1)
+	if len(matches) < 1 {
+		return nil, false
+	}
+
+	sprint := make(map[string]interface{})
+	for i, match := range matches {
+		end := len(value) - 1
+		if i < len(matches)-1 {
+			end = matches[i+1][0]
+		}
+
+		name, raw := value[match[2]:match[3]], value[match[1]:end]
+
+		switch {
+		case raw == "<null>":
+			sprint[name] = nil
+		case name == "id" || name == "rapidViewId" || name == "sequence":
+			number, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return nil, false
+			}
+			sprint[name] = number
+		default:
+			sprint[name] = raw
+		}
+	}
+
+	return sprint, true
+}
@@ -0,0 +1,110 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+
+	jira "github.com/andygrunwald/go-jira"
+)
+
+func TestParseLegacySprint(t *testing.T) {
+	got, ok := parseLegacySprint("com.atlassian.greenhopper.service.sprint.Sprint@1a2b3c[id=12,rapidViewId=3,state=CLOSED,name=Sprint 4, the return,goal=<null>,startDate=2019-11-04T09:00:00.000+01:00,endDate=2019-11-15T17:00:00.000+01:00,completeDate=<null>,sequence=12]")
+	if !ok {
+		t.Fatal("legacy sprint not parsed")
+	}
+
+	expect := map[string]interface{}{
+		"id":           float64(12),
+		"rapidViewId":  float64(3),
+		"state":        "CLOSED",
+		"name":         "Sprint 4, the return",
+		"goal":         nil,
+		"startDate":    "2019-11-04T09:00:00.000+01:00",
+		"endDate":      "2019-11-15T17:00:00.000+01:00",
+		"completeDate": nil,
+		"sequence":     float64(12),
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got invalid sprint: %v\nexpected: %v", got, expect)
+	}
+
+	if _, ok := parseLegacySprint("Sprint 4"); ok {
+		t.Fatal("parsed plain string as legacy sprint")
+	}
+}
+
+func TestFieldExtractionOfLegacySprints(t *testing.T) {
+	issue := Issue{
+		"key": "ABC-1",
+		"fields": map[string]interface{}{
+			"customfield_10010": []interface{}{
+				"com.atlassian.greenhopper.service.sprint.Sprint@1[id=1,rapidViewId=3,state=CLOSED,name=Sprint 1,sequence=1]",
+				"com.atlassian.greenhopper.service.sprint.Sprint@2[id=2,rapidViewId=3,state=ACTIVE,name=Sprint 2,sequence=2]",
+			},
+		},
+	}
+
+	extractor := FieldExtractor{
+		FieldSchema{Name: "sprints", Type: "STRING", Path: "fields.customfield_10010.name", Repeated: true},
+		FieldSchema{Name: "sprintIds", Type: "INTEGER", Path: "fields.customfield_10010.id", Repeated: true},
+	}
+
+	// other fields are not parsed
+	parseSprintField([]Issue{issue}, "customfield_10011")
+	got, err := extractor.extractRow(issue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := (Issue{"sprints": []interface{}{}, "sprintIds": []interface{}{}}); !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got invalid sprint fields: %v\nexpected: %v", got, expect)
+	}
+
+	parseSprintField([]Issue{issue}, "customfield_10010")
+	got, err = extractor.extractRow(issue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := Issue{
+		"sprints":   []interface{}{"Sprint 1", "Sprint 2"},
+		"sprintIds": []interface{}{float64(1), float64(2)},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got invalid sprint fields: %v\nexpected: %v", got, expect)
+	}
+}
+
+func TestAgileFollowsPages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start, _ := strconv.Atoi(r.URL.Query().Get("startAt"))
+		if r.URL.Query().Get("projectKeyOrId") != "ABC" {
+			http.Error(w, "missing project", http.StatusBadRequest)
+			return
+		}
+
+		page := agilePage{StartAt: start, MaxResults: 2, IsLast: start >= 2}
+		for i := start; i < start+2 && i < 3; i++ {
+			page.Values = append(page.Values, Issue{"id": i, "type": "scrum"})
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer server.Close()
+
+	client, err := jira.NewClient(nil, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := JiraClient{Client: client, Project: "ABC"}.Boards(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got invalid amount of boards: %v\nexpected: %v", len(got), 3)
+	}
+}
@@ -0,0 +1,277 @@
+package function
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// archiveExtension of the gzip compressed JSON objects in an archive
+const archiveExtension = ".json.gz"
+
+// Archive stores the raw JSON of fetched issues, so they can be extracted again after the schema changed
+// Every version of an issue is stored as it's own object at `<issue id>/<update time>.json.gz`
+type Archive interface {
+	// Store the issues as returned by Jira, versions which are already archived get overwritten
+	Store(ctx context.Context, issues []Issue) error
+	// Issues calls fn with each archived version named after after, ordered by issue id and update time
+	// The name passed to fn is relative to the archive's root, so a later call can continue after it
+	// Iterating stops at the first error returned by fn, which gets returned
+	Issues(ctx context.Context, after string, fn func(name string, issue Issue) error) error
+	// Close the clients held by the archive
+	Close() error
+}
+
+// NewArchive from the environment's ARCHIVE url
+// Supported are `gs://bucket/prefix` and `file://path`
+func NewArchive(ctx context.Context, env Environment) (Archive, error) {
+	location, err := url.Parse(env.Archive)
+	if err != nil {
+		return nil, err
+	}
+
+	switch location.Scheme {
+	case "gs":
+		client, err := NewStorageClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return StorageArchive{Bucket: client.Bucket(location.Host), Prefix: strings.Trim(location.Path, "/"), client: client}, nil
+	case "file":
+		return FileArchive{Path: location.Host + location.Path}, nil
+	}
+
+	return nil, fmt.Errorf("unknown archive: %s", env.Archive)
+}
+
+// archiveName of the issue's current version relative to the archive's root
+// The update time is converted to UTC, so the names of an issue's versions sort chronologically
+func archiveName(issue Issue) (string, error) {
+	id, ok := issue["id"]
+	if !ok {
+		return "", fmt.Errorf("invalid issue: missing id: %v", issue["key"])
+	}
+
+	fields, _ := issue["fields"].(map[string]interface{})
+	updated, err := time.Parse(jiraTimestamp, fmt.Sprint(fields["updated"]))
+	if err != nil {
+		return "", fmt.Errorf("invalid issue: %v: updated: %v", issue["key"], err)
+	}
+
+	return fmt.Sprintf("%v/%s%s", id, updated.UTC().Format("20060102T150405.000Z"), archiveExtension), nil
+}
+
+// encodeArchived issue into w as gzip compressed JSON
+func encodeArchived(w io.Writer, issue Issue) error {
+	compressed := gzip.NewWriter(w)
+	if err := json.NewEncoder(compressed).Encode(issue); err != nil {
+		compressed.Close()
+		return err
+	}
+
+	return compressed.Close()
+}
+
+// decodeArchived issue from the gzip compressed JSON in r
+func decodeArchived(r io.Reader) (Issue, error) {
+	compressed, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer compressed.Close()
+
+	var issue Issue
+	if err := json.NewDecoder(compressed).Decode(&issue); err != nil {
+		return nil, err
+	}
+
+	return issue, nil
+}
+
+// sameIssue reports whether both archived versions belong to the same issue
+func sameIssue(a, b Issue) bool {
+	return a != nil && b != nil && fmt.Sprint(a["id"]) == fmt.Sprint(b["id"])
+}
+
+// StorageArchive stores the issues as objects in Google Cloud Storage
+type StorageArchive struct {
+	Bucket *storage.BucketHandle
+	// Prefix of all object names, without trailing slash
+	Prefix string
+
+	client *storage.Client
+}
+
+// object for the name relative to the archive's prefix
+func (a StorageArchive) object(name string) *storage.ObjectHandle {
+	if len(a.Prefix) < 1 {
+		return a.Bucket.Object(name)
+	}
+	return a.Bucket.Object(path.Join(a.Prefix, name))
+}
+
+// Store the issues as objects below the prefix
+func (a StorageArchive) Store(ctx context.Context, issues []Issue) error {
+	for _, issue := range issues {
+		name, err := archiveName(issue)
+		if err != nil {
+			return err
+		}
+
+		writer := a.object(name).NewWriter(ctx)
+		writer.ContentType = "application/json"
+		writer.ContentEncoding = "gzip"
+
+		if err := encodeArchived(writer, issue); err != nil {
+			writer.Close()
+			return err
+		}
+		if err := writer.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Issues stored below the prefix, objects are listed in lexicographic order by Cloud Storage
+func (a StorageArchive) Issues(ctx context.Context, after string, fn func(name string, issue Issue) error) error {
+	query := &storage.Query{}
+	if len(a.Prefix) > 0 {
+		query.Prefix = a.Prefix + "/"
+	}
+
+	objects := a.Bucket.Objects(ctx, query)
+	for {
+		attrs, err := objects.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimPrefix(attrs.Name, query.Prefix)
+		if !strings.HasSuffix(name, archiveExtension) || name <= after {
+			continue
+		}
+
+		// the compressed object is requested, as it gets decompressed by decodeArchived
+		reader, err := a.Bucket.Object(attrs.Name).ReadCompressed(true).NewReader(ctx)
+		if err != nil {
+			return err
+		}
+
+		issue, err := decodeArchived(reader)
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("reading %s: %v", attrs.Name, err)
+		}
+		if err := fn(name, issue); err != nil {
+			return err
+		}
+	}
+}
+
+// Close the storage client, if the archive created it
+func (a StorageArchive) Close() error {
+	if a.client == nil {
+		return nil
+	}
+	return a.client.Close()
+}
+
+// FileArchive stores the issues as files in a local directory
+type FileArchive struct {
+	Path string
+}
+
+// Close is a no-op, as files are only opened while reading or writing
+func (a FileArchive) Close() error {
+	return nil
+}
+
+// Store the issues as files below the directory, which gets created if it does not exist
+func (a FileArchive) Store(ctx context.Context, issues []Issue) error {
+	for _, issue := range issues {
+		name, err := archiveName(issue)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(a.Path, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		file, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		if err := encodeArchived(file, issue); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Issues stored below the directory, the files are only listed upfront and read one by one
+func (a FileArchive) Issues(ctx context.Context, after string, fn func(name string, issue Issue) error) error {
+	var names []string
+	err := filepath.Walk(a.Path, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(file, archiveExtension) {
+			return nil
+		}
+
+		name, err := filepath.Rel(a.Path, file)
+		if err != nil {
+			return err
+		}
+		if name = filepath.ToSlash(name); name > after {
+			names = append(names, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		file, err := os.Open(filepath.Join(a.Path, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+
+		issue, err := decodeArchived(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("reading %s: %v", name, err)
+		}
+		if err := fn(name, issue); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
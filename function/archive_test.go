@@ -0,0 +1,283 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func archivedIssue(id, key, updated, summary string) Issue {
+	return Issue{"id": id, "key": key, "fields": map[string]interface{}{"updated": updated, "summary": summary}}
+}
+
+func TestFileArchiveReturnsVersionsInOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	archive := FileArchive{Path: dir}
+
+	// the second version is older in UTC, although it's local time is later
+	if err := archive.Store(ctx, []Issue{
+		archivedIssue("10001", "ABC-2", "2019-11-12T10:00:00.000+0100", "second issue"),
+		archivedIssue("10000", "ABC-1", "2019-11-12T12:00:00.000+0100", "latest"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.Store(ctx, []Issue{
+		archivedIssue("10000", "ABC-1", "2019-11-12T12:30:00.000+0200", "oldest"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var names, summaries []string
+	if err := archive.Issues(ctx, "", func(name string, issue Issue) error {
+		names = append(names, name)
+		summaries = append(summaries, issue["fields"].(map[string]interface{})["summary"].(string))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got, expect := strings.Join(summaries, ","), "oldest,latest,second issue"; got != expect {
+		t.Fatalf("got invalid issues: %v\nexpected: %v", got, expect)
+	}
+
+	var after []string
+	if err := archive.Issues(ctx, names[0], func(name string, issue Issue) error {
+		after = append(after, name)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(after, names[1:]) {
+		t.Fatalf("got invalid issues after %s: %v\nexpected: %v", names[0], after, names[1:])
+	}
+}
+
+func TestReprocessExtractsArchivedIssues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reprocess")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	env := Environment{
+		Sink:         NDJSONSink,
+		SinkPath:     dir,
+		SchemaPath:   filepath.Join(dir, "schema.json"),
+		Archive:      "file://" + filepath.Join(dir, "archive"),
+		BigQueryMode: MergeMode,
+		BigQueryKey:  "issue",
+	}
+
+	schema, err := json.Marshal([]FieldSchema{
+		FieldSchema{Name: "issue", Type: "STRING", Path: "key", Required: true},
+		FieldSchema{Name: "summary", Type: "STRING", Path: "fields.summary"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(env.SchemaPath, schema, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (FileArchive{Path: filepath.Join(dir, "archive")}).Store(ctx, []Issue{
+		archivedIssue("10000", "ABC-1", "2019-11-12T10:00:00.000+0100", "old"),
+		archivedIssue("10000", "ABC-1", "2019-11-12T11:00:00.000+0100", "new"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Reprocess(ctx, env, RunOptions{Sync: ReprocessSync}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join(dir, "issues.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "{\"issue\":\"ABC-1\",\"summary\":\"new\"}\n"; string(got) != expect {
+		t.Fatalf("got invalid rows: %v\nexpected: %v", string(got), expect)
+	}
+
+	last, err := (&FileSink{Dir: dir, Table: "issues", Format: NDJSONSink}).LastExecution(ctx, ReprocessSync)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.Inserted != 1 {
+		t.Fatalf("got invalid execution: %v\nexpected: %v", last.Inserted, 1)
+	}
+}
+
+func TestReprocessRequiresEmptyTableInAppendMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reprocess")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	env := Environment{
+		Sink:       NDJSONSink,
+		SinkPath:   dir,
+		SchemaPath: filepath.Join(dir, "schema.json"),
+		Archive:    "file://" + filepath.Join(dir, "archive"),
+	}
+	if err := ioutil.WriteFile(env.SchemaPath, []byte(`[{"name":"issue","type":"STRING","path":"key"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := (FileArchive{Path: filepath.Join(dir, "archive")}).Store(ctx, []Issue{
+		archivedIssue("10000", "ABC-1", "2019-11-12T10:00:00.000+0100", "old"),
+		archivedIssue("10000", "ABC-1", "2019-11-12T11:00:00.000+0100", "new"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Reprocess(ctx, env, RunOptions{Sync: ReprocessSync}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reprocess(ctx, env, RunOptions{Sync: ReprocessSync}); err == nil {
+		t.Fatalf("got invalid error: %v\nexpected: %v", err, "reprocessing into a table containing rows fails")
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join(dir, "issues.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "{\"issue\":\"ABC-1\"}\n{\"issue\":\"ABC-1\"}\n"; string(got) != expect {
+		t.Fatalf("got invalid rows: %v\nexpected: %v", string(got), expect)
+	}
+}
+
+func TestTruncatedReprocessContinuesAfterLastBatch(t *testing.T) {
+	published, closePubSub := fakePubSub()
+	defer closePubSub()
+
+	dir, err := ioutil.TempDir("", "reprocess")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	env := Environment{
+		Sink:         NDJSONSink,
+		SinkPath:     dir,
+		SchemaPath:   filepath.Join(dir, "schema.json"),
+		Archive:      "file://" + filepath.Join(dir, "archive"),
+		BigQueryMode: MergeMode,
+		BigQueryKey:  "issue",
+		Topic:        "projects/p/topics/t",
+		// the deadline has passed as soon as the run starts
+		RunTimeout: time.Second,
+	}
+	if err := ioutil.WriteFile(env.SchemaPath, []byte(`[{"name":"issue","type":"STRING","path":"key"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the issues have two versions each, only the latest ones are written
+	var issues []Issue
+	for i := 0; i < reprocessBatch+1; i++ {
+		id, key := fmt.Sprintf("%d", 10000+i), fmt.Sprintf("ABC-%d", i+1)
+		issues = append(issues,
+			archivedIssue(id, key, "2019-11-12T10:00:00.000+0000", "old"),
+			archivedIssue(id, key, "2019-11-12T11:00:00.000+0000", "new"),
+		)
+	}
+	if err := (FileArchive{Path: filepath.Join(dir, "archive")}).Store(ctx, issues); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Reprocess(ctx, env, RunOptions{Sync: ReprocessSync}); err != nil {
+		t.Fatal(err)
+	}
+
+	last := fmt.Sprintf("%d/20191112T110000.000Z.json.gz", 10000+reprocessBatch-1)
+	if expect := []RunOptions{{Sync: ReprocessSync, After: last}}; !reflect.DeepEqual(*published, expect) {
+		t.Fatalf("got invalid continuations: %+v\nexpected: %+v", *published, expect)
+	}
+
+	exec, err := (&FileSink{Dir: dir, Table: "issues", Format: NDJSONSink}).LastExecution(ctx, ReprocessSync)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exec.Inserted != reprocessBatch {
+		t.Fatalf("got invalid execution: %v\nexpected: %v", exec.Inserted, reprocessBatch)
+	}
+
+	// the continuation writes the remaining issue
+	env.Topic = ""
+	if err := Reprocess(ctx, env, (*published)[0]); err != nil {
+		t.Fatal(err)
+	}
+	if exec, err = (&FileSink{Dir: dir, Table: "issues", Format: NDJSONSink}).LastExecution(ctx, ReprocessSync); err != nil || exec.Inserted != 1 {
+		t.Fatalf("got invalid execution: %v, %v\nexpected: %v", exec.Inserted, err, 1)
+	}
+}
+
+func TestStoppedReprocessResumesFromCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reprocess")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	env := Environment{
+		Sink:       NDJSONSink,
+		SinkPath:   dir,
+		SchemaPath: filepath.Join(dir, "schema.json"),
+		Archive:    "file://" + filepath.Join(dir, "archive"),
+		Checkpoint: "file://" + filepath.Join(dir, "checkpoint.json"),
+	}
+	if err := ioutil.WriteFile(env.SchemaPath, []byte(`[{"name":"issue","type":"STRING","path":"key"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var issues []Issue
+	for i := 0; i < reprocessBatch+1; i++ {
+		issues = append(issues, archivedIssue(fmt.Sprintf("%d", 10000+i), fmt.Sprintf("ABC-%d", i+1), "2019-11-12T10:00:00.000+0000", "summary"))
+	}
+	if err := (FileArchive{Path: filepath.Join(dir, "archive")}).Store(ctx, issues); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first run gets stopped like by a shutdown of the daemon, without topic only the checkpoint keeps it's position
+	stopped := make(chan struct{})
+	close(stopped)
+	for _, c := range []struct {
+		ctx  context.Context
+		rows int
+	}{
+		{withStop(ctx, stopped), reprocessBatch},
+		{ctx, reprocessBatch + 1},
+	} {
+		if err := Reprocess(c.ctx, env, RunOptions{Sync: ReprocessSync}); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := ioutil.ReadFile(filepath.Join(dir, "issues.ndjson"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rows := strings.Count(string(got), "\n"); rows != c.rows {
+			t.Fatalf("got invalid amount of rows: %v\nexpected: %v", rows, c.rows)
+		}
+	}
+
+	// the completed run removed the position, so the next one starts over and requires an empty table again
+	if err := Reprocess(ctx, env, RunOptions{Sync: ReprocessSync}); err == nil {
+		t.Fatalf("got invalid error: %v\nexpected: %v", err, "reprocessing into a table containing rows fails")
+	}
+}
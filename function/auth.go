@@ -19,8 +19,39 @@ type JiraAuth struct {
 	Password string `json:"password,omitempty"`
 }
 
+// LoadJiraAuth from the environment
+// If no KMS resource is configured, the secret is expected to contain the plain JSON encoded JiraAuth,
+// which allows running without a Google Cloud project
+func LoadJiraAuth(ctx context.Context, env Environment) (*JiraAuth, error) {
+	if len(env.JiraAuthResource) > 0 {
+		return DecodeJiraAuth(ctx, env.JiraAuthResource, env.JiraAuthSecret)
+	}
+
+	var auth *JiraAuth
+	if err := json.Unmarshal([]byte(env.JiraAuthSecret), &auth); err != nil {
+		return nil, err
+	}
+
+	return auth, nil
+}
+
 // DecodeJiraAuth from the provided resource and secret
 func DecodeJiraAuth(ctx context.Context, resource, secret string) (*JiraAuth, error) {
+	plaintext, err := decrypt(ctx, resource, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	var auth *JiraAuth
+	if err := json.Unmarshal(plaintext, &auth); err != nil {
+		return nil, err
+	}
+
+	return auth, nil
+}
+
+// decrypt the base64 encoded secret using the KMS resource
+func decrypt(ctx context.Context, resource, secret string) ([]byte, error) {
 
 	raw, err := base64.StdEncoding.DecodeString(secret)
 	if err != nil {
@@ -43,12 +74,7 @@ func DecodeJiraAuth(ctx context.Context, resource, secret string) (*JiraAuth, er
 		return nil, err
 	}
 
-	var auth *JiraAuth
-	if err := json.Unmarshal(resp.GetPlaintext(), &auth); err != nil {
-		return nil, err
-	}
-
-	return auth, nil
+	return resp.GetPlaintext(), nil
 }
 
 // EncodeJiraAuth for the provided resource
@@ -58,6 +84,11 @@ func EncodeJiraAuth(ctx context.Context, resource string, auth *JiraAuth) (strin
 		log.From(ctx).Fatal("encoding auth", zap.Error(err))
 	}
 
+	return encrypt(ctx, resource, authJSON)
+}
+
+// encrypt the plaintext using the KMS resource and return it base64 encoded
+func encrypt(ctx context.Context, resource string, plaintext []byte) (string, error) {
 	client, err := kms.NewKeyManagementClient(ctx)
 	if err != nil {
 		return "", err
@@ -65,7 +96,7 @@ func EncodeJiraAuth(ctx context.Context, resource string, auth *JiraAuth) (strin
 
 	req := &kmspb.EncryptRequest{
 		Name:      resource,
-		Plaintext: authJSON,
+		Plaintext: plaintext,
 	}
 
 	// Call the API.
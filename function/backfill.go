@@ -0,0 +1,183 @@
+package function
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/seibert-media/golibs/log"
+	"go.uber.org/zap"
+)
+
+// timeRange starting at since and ending before until
+type timeRange struct {
+	since, until time.Time
+}
+
+// backfillWindows splitting the range from since until until, the last window ends at until
+func backfillWindows(since, until time.Time, window string) []timeRange {
+	next := func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+	switch window {
+	case WeekWindow:
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+	case DayWindow:
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	}
+
+	var windows []timeRange
+	for start := since; start.Before(until); start = next(start) {
+		end := next(start)
+		if end.After(until) {
+			end = until
+		}
+		windows = append(windows, timeRange{since: start, until: end})
+	}
+
+	return windows
+}
+
+// Backfill writes all issues updated within the range of opts into the sink, one window after another
+// Every window is recorded as execution of the BackfillSync with the end of the window as it's checkpoint,
+// so a backfill aborted by a timeout continues after the last completed window when it is triggered again
+// A backfill reaching it's deadline triggers that continuation itself, if the environment has a topic
+// The checkpoint of the IssuesSync is not changed
+// In a dry run, the rows are printed to stdout instead and nothing gets created, written or recorded
+func Backfill(ctx context.Context, env Environment, opts RunOptions) error {
+	if err := opts.validateMode(env.BigQueryMode); err != nil {
+		log.From(ctx).Error("validating run options", zap.Error(err))
+		return err
+	}
+
+	since, until, err := opts.Range(time.Now())
+	if err != nil {
+		log.From(ctx).Error("parsing range", zap.Error(err))
+		return err
+	}
+
+	sink, checkpoints, err := openSink(ctx, env, opts, BackfillSync)
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+	defer checkpoints.Close()
+
+	fields, err := GetSchema(ctx, env.SchemaBucket, env.SchemaPath)
+	if err != nil {
+		log.From(ctx).Error("reading schema", zap.String("bucket", env.SchemaBucket), zap.String("path", env.SchemaPath), zap.Error(err))
+		return err
+	}
+
+	privacy, err := NewPrivacyFilter(ctx, env, fields)
+	if err != nil {
+		log.From(ctx).Error("loading privacy", zap.Error(err))
+		return err
+	}
+
+	if err := sink.Prepare(ctx, fields); err != nil {
+		log.From(ctx).Error("preparing sink", zap.Error(err))
+		return err
+	}
+
+	log.From(ctx).Debug("loading checkpoint")
+	last, err := checkpoints.Load(ctx)
+	if err != nil {
+		log.From(ctx).Error("loading checkpoint", zap.Error(err))
+		return err
+	}
+
+	// only a checkpoint within the range belongs to an aborted backfill of it, completed backfills start over
+	if last.Timestamp.After(since) && last.Timestamp.Before(until) {
+		log.From(ctx).Info("resuming backfill", zap.Time("checkpoint", last.Timestamp))
+		since = last.Timestamp
+	}
+
+	log.From(ctx).Debug("creating jira client")
+	jira, err := NewJiraClient(ctx, env)
+	if err != nil {
+		log.From(ctx).Error("creating jira client", zap.Error(err))
+		return err
+	}
+
+	jira.Deadline = runDeadline(ctx, env, opts, time.Now())
+
+	windows := backfillWindows(since, until, opts.Window)
+	for i, window := range windows {
+		// the next run resumes after the last completed window
+		if deadlineReached(ctx, jira.Deadline) {
+			log.From(ctx).Info("reached deadline", zap.Int("window", i+1), zap.Int("windows", len(windows)))
+			return Continue(ctx, env, opts)
+		}
+
+		log.From(ctx).Info("backfilling window", zap.Int("window", i+1), zap.Int("windows", len(windows)), zap.Time("since", window.since), zap.Time("until", window.until))
+		truncated, err := backfillWindow(ctx, env, opts, sink, checkpoints, jira, fields, privacy, window)
+		if err != nil {
+			return err
+		}
+		if truncated {
+			return Continue(ctx, env, opts)
+		}
+	}
+
+	log.From(ctx).Info("backfilled", zap.Int("windows", len(windows)))
+	return nil
+}
+
+// backfillWindow writes the issues updated within the window and records it as execution of the BackfillSync
+// If the client's deadline is reached, the window is truncated after the last fetched issue and it's update time saved as checkpoint
+func backfillWindow(ctx context.Context, env Environment, opts RunOptions, sink Sink, checkpoints CheckpointStore, jira JiraClient, fields []FieldSchema, privacy PrivacyFilter, window timeRange) (truncated bool, err error) {
+	exec := Execution{
+		Timestamp:  time.Now().UTC(),
+		Version:    env.Version,
+		Sync:       BackfillSync,
+		SchemaHash: SchemaHash(fields),
+		Checkpoint: bigquery.NullTimestamp{Timestamp: window.until, Valid: true},
+	}
+	defer recordExecution(ctx, sink, &exec, &err)
+
+	exec.JQL, err = jira.RangeQuery(window.since, window.until)
+	if err != nil {
+		log.From(ctx).Error("building query", zap.Error(err))
+		return false, err
+	}
+
+	log.From(ctx).Info("fetching issues", zap.String("jql", exec.JQL))
+	issues, err := jira.Issues(ctx, exec.JQL, 0)
+	truncated = err == ErrDeadline
+	if err != nil && !truncated {
+		log.From(ctx).Error("fetching issues", zap.Error(err))
+		return false, err
+	}
+	exec.Fetched = len(issues)
+
+	if err := archiveIssues(ctx, env, opts, issues); err != nil {
+		return false, err
+	}
+
+	if err := writeIssues(ctx, env, opts, sink, fields, privacy, issues, &exec); err != nil {
+		return false, err
+	}
+
+	next := Checkpoint{Timestamp: window.until}
+	if truncated {
+		if next.Timestamp, err = cursor(issues); err != nil {
+			log.From(ctx).Error("reading cursor", zap.Error(err))
+			return false, err
+		}
+		if !advances(next.Timestamp, window.since) {
+			err = fmt.Errorf("reached deadline without progress: all fetched issues were updated at %s", next.Timestamp.Format(time.RFC3339))
+			log.From(ctx).Error("reading cursor", zap.Error(err))
+			return false, err
+		}
+		exec.Checkpoint = bigquery.NullTimestamp{Timestamp: next.Timestamp, Valid: true}
+	}
+
+	log.From(ctx).Debug("saving checkpoint")
+	if err := checkpoints.Save(ctx, next); err != nil {
+		log.From(ctx).Error("saving checkpoint", zap.Error(err))
+		return false, err
+	}
+
+	log.From(ctx).Info("inserted", zap.Int("issues", exec.Inserted))
+	return truncated, nil
+}
@@ -0,0 +1,127 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+)
+
+func TestBackfillWindows(t *testing.T) {
+	since := time.Date(2019, 1, 15, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	got := backfillWindows(since, until, "")
+	expect := []timeRange{
+		{since, time.Date(2019, 2, 15, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2019, 2, 15, 0, 0, 0, 0, time.UTC), until},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got invalid windows: %v\nexpected: %v", got, expect)
+	}
+
+	if got := backfillWindows(since, until, WeekWindow); len(got) != 7 {
+		t.Fatalf("got invalid amount of weekly windows: %v\nexpected: %v", len(got), 7)
+	}
+}
+
+func TestRunOptionsValidatesBackfillRange(t *testing.T) {
+	for _, c := range []struct {
+		opts  RunOptions
+		valid bool
+	}{
+		{RunOptions{Sync: BackfillSync, Since: "2019-01-01"}, true},
+		{RunOptions{Sync: BackfillSync, Since: "2019-01-01T10:00:00+02:00", Until: "2019-02-01", Window: DayWindow}, true},
+		{RunOptions{Sync: BackfillSync}, false},
+		{RunOptions{Sync: BackfillSync, Since: "01.01.2019"}, false},
+		{RunOptions{Sync: BackfillSync, Since: "2019-02-01", Until: "2019-01-01"}, false},
+		{RunOptions{Sync: BackfillSync, Since: "2019-01-01", Window: "year"}, false},
+	} {
+		if err := c.opts.Validate(); (err == nil) != c.valid {
+			t.Fatalf("got invalid error for %+v: %v\nexpected valid: %v", c.opts, err, c.valid)
+		}
+	}
+}
+
+func TestBackfillResumesAfterLastWindow(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rest/api/2/myself":
+			w.Write([]byte(`{"timeZone":"UTC"}`))
+		case "/rest/api/2/search":
+			queries = append(queries, r.URL.Query().Get("jql"))
+			fmt.Fprintf(w, `{"startAt":0,"maxResults":500,"total":1,"issues":[{"id":"%d","key":"ABC-%d","fields":{"updated":"2019-02-10T10:00:00.000+0000"}}]}`, len(queries), len(queries))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "backfill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	auth, err := json.Marshal(JiraAuth{URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := Environment{
+		JiraAuthSecret: string(auth),
+		JiraProject:    "ABC",
+		Sink:           NDJSONSink,
+		SinkPath:       dir,
+		SchemaPath:     filepath.Join(dir, "schema.json"),
+	}
+	if err := ioutil.WriteFile(env.SchemaPath, []byte(`[{"name":"issue","type":"STRING","path":"key"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first window was completed by an earlier run, which got aborted afterwards
+	sink := &FileSink{Dir: dir, Table: "issues", Format: NDJSONSink}
+	if err := sink.RecordExecution(ctx, Execution{
+		Timestamp:  time.Now().UTC(),
+		Status:     ExecutionSucceeded,
+		Sync:       BackfillSync,
+		Checkpoint: bigquery.NullTimestamp{Timestamp: time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Backfill(ctx, env, RunOptions{Sync: BackfillSync, Since: "2019-01-01", Until: "2019-03-01"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{`project = ABC AND updated >= "2019-02-01 00:00" AND updated < "2019-03-01 00:00" ORDER BY updated ASC`}
+	if !reflect.DeepEqual(queries, expect) {
+		t.Fatalf("got invalid queries: %v\nexpected: %v", queries, expect)
+	}
+
+	last, err := sink.LastExecution(ctx, BackfillSync)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !last.checkpoint().Equal(time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)) || last.Inserted != 1 {
+		t.Fatalf("got invalid execution: %+v\nexpected: %v", last, "checkpoint at 2019-03-01 with 1 inserted issue")
+	}
+
+	issues, err := sink.LastExecution(ctx, IssuesSync)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !issues.Timestamp.IsZero() {
+		t.Fatalf("got invalid issues execution: %v\nexpected: %v", issues.Timestamp, "none")
+	}
+}
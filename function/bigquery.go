@@ -1,15 +1,35 @@
 package function
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/civil"
 	"github.com/seibert-media/golibs/log"
 	"go.uber.org/zap"
 	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+)
+
+const (
+	// AppendMode streams every fetched issue into the table, keeping all previous versions
+	AppendMode = "append"
+	// MergeMode keeps a single current-state row per issue in the table
+	MergeMode = "merge"
+	// SnapshotMode writes the full current state of all issues into a daily partition of the table
+	SnapshotMode = "snapshot"
+
+	// StreamInsert writes rows using the streaming api
+	StreamInsert = "stream"
+	// LoadInsert writes rows by running a load job with newline-delimited JSON
+	LoadInsert = "load"
 )
 
 // BigQueryClient wraps a bigquery.Client to provide helpers
@@ -19,6 +39,19 @@ type BigQueryClient struct {
 	Dataset   *bigquery.Dataset
 	Table     *bigquery.Table
 	ExecTable *bigquery.Table
+
+	// Mode the client writes issues in, either AppendMode, MergeMode or SnapshotMode
+	Mode string
+	// Key is the column identifying an issue in MergeMode
+	Key string
+	// InsertMode defines how rows are sent to BigQuery, either StreamInsert or LoadInsert
+	InsertMode string
+	// StagingTable receives each batch before it gets merged into Table in MergeMode
+	StagingTable *bigquery.Table
+	// HistoryTable keeps the append-only rows in MergeMode, nil if disabled
+	HistoryTable *bigquery.Table
+
+	fields []FieldSchema
 }
 
 // NewBigQueryClient for the provided environment
@@ -30,17 +63,41 @@ func NewBigQueryClient(ctx context.Context, env Environment) (*BigQueryClient, e
 
 	dataset := client.Dataset(env.BigQueryDataset)
 
-	return &BigQueryClient{
+	c := &BigQueryClient{
 		Client: client,
 		//Project:   env.GoogleProject,
-		Dataset:   dataset,
-		Table:     dataset.Table(env.BigQueryTable),
-		ExecTable: dataset.Table(fmt.Sprintf("%s_executions", env.BigQueryTable)),
-	}, nil
+		Dataset:    dataset,
+		Table:      dataset.Table(env.BigQueryTable),
+		ExecTable:  dataset.Table(fmt.Sprintf("%s_executions", env.BigQueryTable)),
+		Mode:       env.BigQueryMode,
+		Key:        env.BigQueryKey,
+		InsertMode: env.BigQueryInsertMode,
+	}
+
+	if len(c.Mode) < 1 {
+		c.Mode = AppendMode
+	}
+	if len(c.InsertMode) < 1 {
+		c.InsertMode = StreamInsert
+	}
+
+	if c.Mode == MergeMode {
+		c.StagingTable = dataset.Table(fmt.Sprintf("%s_staging", env.BigQueryTable))
+		if env.BigQueryHistory {
+			c.HistoryTable = dataset.Table(fmt.Sprintf("%s_history", env.BigQueryTable))
+		}
+	}
+
+	return c, nil
 }
 
 // Prepare the client by creating it's dataset and table
 func (c *BigQueryClient) Prepare(ctx context.Context, fields []FieldSchema) error {
+	if c.Mode == MergeMode && !hasField(fields, c.Key) {
+		return fmt.Errorf("merge key %q is not part of the schema", c.Key)
+	}
+	c.fields = fields
+
 	log.From(ctx).Debug("creating dataset")
 	if err := c.CreateDataset(ctx); err != nil {
 		log.From(ctx).Error("creating dataset", zap.Error(err))
@@ -48,7 +105,7 @@ func (c *BigQueryClient) Prepare(ctx context.Context, fields []FieldSchema) erro
 	}
 
 	log.From(ctx).Debug("creating table")
-	if err := c.CreateTable(ctx, BigQuerySchema(fields)); err != nil {
+	if err := c.CreateTable(ctx, c.schema()); err != nil {
 		log.From(ctx).Error("creating table", zap.Error(err))
 		return err
 	}
@@ -56,6 +113,18 @@ func (c *BigQueryClient) Prepare(ctx context.Context, fields []FieldSchema) erro
 	return nil
 }
 
+// schema of the client's table, which contains the snapshotColumn in SnapshotMode
+func (c *BigQueryClient) schema() bigquery.Schema {
+	schema := BigQuerySchema(c.fields)
+	if c.Mode == SnapshotMode {
+		schema = append(schema, &bigquery.FieldSchema{Name: snapshotColumn, Required: true, Type: bigquery.DateFieldType})
+	}
+	return schema
+}
+
+// snapshotColumn contains the date of the snapshot a row belongs to in SnapshotMode
+const snapshotColumn = "snapshot_date"
+
 // CreateDataset if it does not exist
 func (c *BigQueryClient) CreateDataset(ctx context.Context) error {
 	if err := c.Dataset.Create(ctx, &bigquery.DatasetMetadata{}); err != nil && !isExists(err) {
@@ -65,56 +134,450 @@ func (c *BigQueryClient) CreateDataset(ctx context.Context) error {
 	return nil
 }
 
-// CreateTable and the respective executions table, if it does not exist
+// CreateTable and the respective executions, staging and history tables, if they do not exist
 func (c *BigQueryClient) CreateTable(ctx context.Context, schema bigquery.Schema) error {
-	if err := c.Table.Create(ctx, &bigquery.TableMetadata{Schema: schema}); err != nil && !isExists(err) {
-		log.From(ctx).Error("creating table", zap.Error(err))
-		return err
+	for _, table := range []*bigquery.Table{c.Table, c.StagingTable, c.HistoryTable} {
+		if table == nil {
+			continue
+		}
+		meta := &bigquery.TableMetadata{Schema: schema}
+		if c.Mode == SnapshotMode {
+			meta.TimePartitioning = &bigquery.TimePartitioning{Field: snapshotColumn}
+		}
+		if err := table.Create(ctx, meta); err != nil && !isExists(err) {
+			log.From(ctx).Error("creating table", zap.String("table", table.TableID), zap.Error(err))
+			return err
+		}
 	}
 
-	if err := c.ExecTable.Create(ctx, &bigquery.TableMetadata{Schema: bigquery.Schema{
-		&bigquery.FieldSchema{Name: "timestamp", Required: true, Type: bigquery.TimestampFieldType},
-		&bigquery.FieldSchema{Name: "inserted", Required: true, Type: bigquery.IntegerFieldType},
-	}, TimePartitioning: &bigquery.TimePartitioning{Field: "timestamp"}}); err != nil && !isExists(err) {
+	if err := c.ExecTable.Create(ctx, &bigquery.TableMetadata{
+		Schema:           executionSchema,
+		TimePartitioning: &bigquery.TimePartitioning{Field: "timestamp"},
+	}); err != nil && !isExists(err) {
 		log.From(ctx).Error("creating executions table", zap.Error(err))
 		return err
 	}
 
+	if err := c.addMissingColumns(ctx, c.ExecTable, executionSchema); err != nil {
+		log.From(ctx).Error("updating executions table", zap.Error(err))
+		return err
+	}
+
 	return nil
 }
 
-// Insert into the client's table
-func (c *BigQueryClient) Insert(ctx context.Context, issues []Issue) error {
-	inserter := c.Table.Inserter()
+// addMissingColumns from schema to an existing table
+// This only works for nullable columns, as BigQuery does not allow adding required ones
+func (c *BigQueryClient) addMissingColumns(ctx context.Context, table *bigquery.Table, schema bigquery.Schema) error {
+	meta, err := table.Metadata(ctx)
+	if err != nil {
+		return err
+	}
+
+	existing := make(map[string]bool)
+	for _, field := range meta.Schema {
+		existing[strings.ToLower(field.Name)] = true
+	}
+
+	updated := meta.Schema
+	for _, field := range schema {
+		if !existing[strings.ToLower(field.Name)] {
+			log.From(ctx).Info("adding column", zap.String("table", table.TableID), zap.String("column", field.Name))
+			updated = append(updated, field)
+		}
+	}
+
+	if len(updated) == len(meta.Schema) {
+		return nil
+	}
+
+	_, err = table.Update(ctx, bigquery.TableMetadataToUpdate{Schema: updated}, meta.ETag)
+	return err
+}
+
+// Insert into the client's table and return the amount of rows written to it
+// In MergeMode the issues are loaded into the staging table and merged into the table afterwards,
+// replacing existing rows with the same key
+// In SnapshotMode the issues replace the content of today's partition
+func (c *BigQueryClient) Insert(ctx context.Context, issues []Issue) (inserted int, err error) {
+	start := time.Now()
+	defer func() { observeInsert(c.Table.TableID, start, len(issues), inserted, err) }()
+
+	if c.Mode == SnapshotMode {
+		return c.snapshot(ctx, time.Now().UTC(), issues)
+	}
+	if c.Mode != MergeMode {
+		return c.insert(ctx, c.Table, issues)
+	}
+
+	if c.HistoryTable != nil {
+		log.From(ctx).Debug("inserting history")
+		if _, err := c.insert(ctx, c.HistoryTable, issues); err != nil {
+			return 0, err
+		}
+	}
+
+	if len(issues) < 1 {
+		return 0, nil
+	}
+
+	// merging fails if several rows of the staging table match the same row, so only the last one is staged
+	log.From(ctx).Debug("loading staging table")
+	if err := c.load(ctx, c.StagingTable, uniqueRows(issues, c.Key), bigquery.WriteTruncate); err != nil {
+		log.From(ctx).Error("loading staging table", zap.Error(err))
+		return 0, err
+	}
+
+	log.From(ctx).Debug("merging staging table")
+	if err := c.exec(ctx, mergeQuery(c.Table, c.StagingTable, c.Key, c.fields)); err != nil {
+		log.From(ctx).Error("merging staging table", zap.Error(err))
+		return 0, err
+	}
+
+	return len(issues), nil
+}
+
+// snapshot replaces the partition of the provided date with the issues
+// A load job is used independent of the InsertMode, so repeated runs on the same day overwrite each other
+func (c *BigQueryClient) snapshot(ctx context.Context, at time.Time, issues []Issue) (int, error) {
+	date := civil.DateOf(at)
+
+	rows := make([]Issue, len(issues))
+	for i, issue := range issues {
+		rows[i] = make(Issue, len(issue)+1)
+		for key, value := range issue {
+			rows[i][key] = value
+		}
+		rows[i][snapshotColumn] = date.String()
+	}
+
+	partition := c.Dataset.Table(fmt.Sprintf("%s$%s", c.Table.TableID, at.Format("20060102")))
+
+	log.From(ctx).Debug("loading snapshot", zap.String("partition", partition.TableID))
+	if err := c.load(ctx, partition, rows, bigquery.WriteTruncate); err != nil {
+		log.From(ctx).Error("loading snapshot", zap.String("partition", partition.TableID), zap.Error(err))
+		return 0, err
+	}
+
+	return len(rows), nil
+}
+
+// insert the issues into table according to the client's InsertMode
+func (c *BigQueryClient) insert(ctx context.Context, table *bigquery.Table, issues []Issue) (int, error) {
+	if c.InsertMode != LoadInsert {
+		return c.stream(ctx, table, issues)
+	}
+
+	if len(issues) < 1 {
+		return 0, nil
+	}
+
+	if err := c.load(ctx, table, issues, bigquery.WriteAppend); err != nil {
+		log.From(ctx).Error("loading table", zap.String("table", table.TableID), zap.Error(err))
+		return 0, err
+	}
+
+	return len(issues), nil
+}
+
+// stream the issues into table using the streaming api
+// The issues are split into chunks respecting the request limits of the api.
+// Chunks failing as a whole get retried, relying on the issues insert ids to prevent duplicates.
+func (c *BigQueryClient) stream(ctx context.Context, table *bigquery.Table, issues []Issue) (int, error) {
+	inserter := table.Inserter()
 	inserter.IgnoreUnknownValues = true
 
-	if err := inserter.Put(ctx, issues); err != nil {
-		putErr := err.(bigquery.PutMultiError)
-		for _, rowErr := range putErr {
-			log.From(ctx).Error("inserting row", zap.Error(rowErr.Errors))
+	batches, err := chunks(issues, maxChunkRows, maxChunkBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	var inserted int
+	for i, batch := range batches {
+		log.From(ctx).Debug("inserting chunk", zap.Int("chunk", i), zap.Int("chunks", len(batches)), zap.Int("rows", len(batch)))
+
+		if err := c.streamChunk(ctx, inserter, table, i, batch); err != nil {
+			if putErr, ok := err.(bigquery.PutMultiError); ok {
+				for _, rowErr := range putErr {
+					log.From(ctx).Error("inserting row", zap.Error(rowErr.Errors))
+				}
+				// the rows without errors of the chunk got inserted
+				inserted += len(batch) - rejectedRows(len(batch), 0, putErr)
+			}
+
+			return inserted, err
+		}
+
+		inserted += len(batch)
+	}
+
+	return inserted, nil
+}
+
+// streamChunk of issues using the inserter, retrying chunks which failed as a whole
+func (c *BigQueryClient) streamChunk(ctx context.Context, inserter *bigquery.Inserter, table *bigquery.Table, chunk int, batch []Issue) (err error) {
+	err = inserter.Put(ctx, batch)
+	for attempt := 1; err != nil && attempt < maxChunkAttempts && !isPutMultiError(err); attempt++ {
+		log.From(ctx).Warn("retrying chunk", zap.Int("chunk", chunk), zap.Int("attempt", attempt), zap.Error(err))
+		insertRetries.WithLabelValues(table.TableID).Inc()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * time.Second):
+		}
+		err = inserter.Put(ctx, batch)
+	}
+
+	return err
+}
+
+const (
+	// maxChunkRows is the amount of rows recommended per streaming insert request
+	maxChunkRows = 500
+	// maxChunkBytes keeps a safe distance to the 10MB limit per streaming insert request
+	maxChunkBytes = 5 << 20
+	// maxChunkAttempts before giving up on inserting a chunk
+	maxChunkAttempts = 3
+)
+
+// chunks splits the issues into batches of at most maxRows issues and roughly maxBytes of encoded size
+func chunks(issues []Issue, maxRows, maxBytes int) ([][]Issue, error) {
+	var batches [][]Issue
+	var batch []Issue
+	var size int
+
+	for _, issue := range issues {
+		encoded, err := json.Marshal(issue)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(batch) > 0 && (len(batch) >= maxRows || size+len(encoded) > maxBytes) {
+			batches = append(batches, batch)
+			batch, size = nil, 0
 		}
 
+		batch = append(batch, issue)
+		size += len(encoded)
+	}
+
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	return batches, nil
+}
+
+func isPutMultiError(err error) bool {
+	_, ok := err.(bigquery.PutMultiError)
+	return ok
+}
+
+// load the issues into table using a load job
+func (c *BigQueryClient) load(ctx context.Context, table *bigquery.Table, issues []Issue, disposition bigquery.TableWriteDisposition) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, issue := range issues {
+		values, _, err := issue.Save()
+		if err != nil {
+			return err
+		}
+		if err := encoder.Encode(values); err != nil {
+			return err
+		}
+	}
+
+	source := bigquery.NewReaderSource(&body)
+	source.SourceFormat = bigquery.JSON
+	source.Schema = c.schema()
+	source.IgnoreUnknownValues = true
+
+	loader := table.LoaderFrom(source)
+	loader.WriteDisposition = disposition
+
+	job, err := loader.Run(ctx)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return wait(ctx, job)
+}
+
+// exec runs the query and waits for it to finish
+func (c *BigQueryClient) exec(ctx context.Context, query string) error {
+	return c.run(ctx, c.Query(query))
 }
 
-// Execution of the inserter
-type Execution struct {
-	Timestamp time.Time `json:"timestamp,omitempty"`
-	Inserted  int       `json:"inserted,omitempty"`
+// run the query and wait for it to finish
+func (c *BigQueryClient) run(ctx context.Context, query *bigquery.Query) error {
+	job, err := query.Run(ctx)
+	if err != nil {
+		return err
+	}
+
+	return wait(ctx, job)
+}
+
+// wait for the job to finish and return it's error, if any
+// All row errors reported by the job get logged, as only the first one is returned
+func wait(ctx context.Context, job *bigquery.Job) error {
+	log.From(ctx).Debug("waiting for job", zap.String("job", job.ID()))
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, rowErr := range status.Errors {
+		log.From(ctx).Error("job error", zap.String("job", job.ID()), zap.Error(rowErr))
+	}
+
+	return status.Err()
+}
+
+// mergeQuery builds a MERGE statement upserting all rows from source into target, matching rows by key
+func mergeQuery(target, source *bigquery.Table, key string, fields []FieldSchema) string {
+	var columns, values, updates []string
+	for _, field := range fields {
+		columns = append(columns, fmt.Sprintf("`%s`", field.Name))
+		values = append(values, fmt.Sprintf("S.`%s`", field.Name))
+		updates = append(updates, fmt.Sprintf("`%s` = S.`%s`", field.Name, field.Name))
+	}
+
+	return fmt.Sprintf(
+		"MERGE %s T USING %s S ON T.`%s` = S.`%s` WHEN MATCHED THEN UPDATE SET %s WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s)",
+		tableName(target), tableName(source), key, key,
+		strings.Join(updates, ", "),
+		strings.Join(columns, ", "),
+		strings.Join(values, ", "),
+	)
+}
+
+// tableName returns the fully qualified and quoted name of table for use in queries
+func tableName(table *bigquery.Table) string {
+	return fmt.Sprintf("`%s.%s.%s`", table.ProjectID, table.DatasetID, table.TableID)
+}
+
+func hasField(fields []FieldSchema, name string) bool {
+	for _, field := range fields {
+		if field.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// deletedColumn marks the rows of issues which no longer exist in Jira, outside of MergeMode
+const deletedColumn = "deleted_at"
+
+// ErrStreamingBuffer is returned by Delete, if rows of the keys were streamed too recently to be changed by DML statements
+// BigQuery keeps streamed rows in it's streaming buffer for up to 90 minutes, a later run can delete them
+var ErrStreamingBuffer = errors.New("rows are still in the streaming buffer")
+
+// Keys of the issues stored in the table, which have not been deleted yet
+func (c *BigQueryClient) Keys(ctx context.Context) ([]string, error) {
+	if len(c.Key) < 1 {
+		return nil, errors.New("reconciling requires a key column, please configure BIGQUERY_KEY")
+	}
+	if c.Mode == SnapshotMode {
+		return nil, errors.New("reconciling is not supported in snapshot mode, deleted issues are missing from the next snapshot")
+	}
+
+	filter := ""
+	if c.Mode != MergeMode {
+		meta, err := c.Table.Metadata(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range meta.Schema {
+			if field.Name == deletedColumn {
+				filter = fmt.Sprintf(" AND `%s` IS NULL", deletedColumn)
+			}
+		}
+	}
+
+	rows, err := c.Query(fmt.Sprintf(
+		"SELECT DISTINCT CAST(`%s` AS STRING) AS key FROM %s WHERE `%s` IS NOT NULL%s",
+		c.Key, tableName(c.Table), c.Key, filter,
+	)).Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for {
+		var row struct {
+			Key string `bigquery:"key"`
+		}
+		err := rows.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, row.Key)
+	}
+
+	return keys, nil
+}
+
+// Delete the issues with the provided keys and return the amount of issues deleted
+// In MergeMode their rows get removed, otherwise all of their rows are marked by setting the deletedColumn to at
+func (c *BigQueryClient) Delete(ctx context.Context, keys []string, at time.Time) (int, error) {
+	if len(keys) < 1 {
+		return 0, nil
+	}
+
+	query := c.Query(fmt.Sprintf(
+		"DELETE FROM %s WHERE CAST(`%s` AS STRING) IN UNNEST(@keys)",
+		tableName(c.Table), c.Key,
+	))
+	query.Parameters = []bigquery.QueryParameter{{Name: "keys", Value: keys}}
+
+	if c.Mode != MergeMode {
+		if err := c.addMissingColumns(ctx, c.Table, bigquery.Schema{
+			&bigquery.FieldSchema{Name: deletedColumn, Type: bigquery.TimestampFieldType, Description: "time the issue was found missing in Jira"},
+		}); err != nil {
+			log.From(ctx).Error("adding deleted column", zap.Error(err))
+			return 0, err
+		}
+
+		query = c.Query(fmt.Sprintf(
+			"UPDATE %s SET `%s` = @at WHERE `%s` IS NULL AND CAST(`%s` AS STRING) IN UNNEST(@keys)",
+			tableName(c.Table), deletedColumn, deletedColumn, c.Key,
+		))
+		query.Parameters = []bigquery.QueryParameter{{Name: "keys", Value: keys}, {Name: "at", Value: at}}
+	}
+
+	if err := c.run(ctx, query); err != nil {
+		if inStreamingBuffer(err) {
+			return 0, ErrStreamingBuffer
+		}
+		return 0, err
+	}
+
+	return len(keys), nil
 }
 
 // RecordExecution in the client's execution table
-func (c *BigQueryClient) RecordExecution(ctx context.Context, at time.Time, inserted int) error {
+func (c *BigQueryClient) RecordExecution(ctx context.Context, exec Execution) (err error) {
+	start := time.Now()
+	defer func() {
+		result := "success"
+		if err != nil {
+			result = "failed"
+		}
+		recordDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+	}()
+
 	inserter := c.ExecTable.Inserter()
 	inserter.IgnoreUnknownValues = true
 
-	if err := inserter.Put(ctx, Execution{Timestamp: at, Inserted: inserted}); err != nil {
-		putErr := err.(bigquery.PutMultiError)
-		for _, rowErr := range putErr {
-			log.From(ctx).Error("inserting row", zap.Error(rowErr.Errors))
+	if err := inserter.Put(ctx, exec); err != nil {
+		if putErr, ok := err.(bigquery.PutMultiError); ok {
+			for _, rowErr := range putErr {
+				log.From(ctx).Error("inserting row", zap.Error(rowErr.Errors))
+			}
 		}
 
 		return err
@@ -122,21 +585,91 @@ func (c *BigQueryClient) RecordExecution(ctx context.Context, at time.Time, inse
 	return nil
 }
 
-// LastExecution .
-func (c *BigQueryClient) LastExecution(ctx context.Context) (Execution, error) {
-	rows, err := c.Query(fmt.Sprintf("SELECT * FROM `%s.%s.%s` ORDER BY timestamp DESC LIMIT 1", c.ExecTable.ProjectID, c.ExecTable.DatasetID, c.ExecTable.TableID)).Read(ctx)
+// Empty reports whether the client's table contains no rows, including rows in the streaming buffer
+func (c *BigQueryClient) Empty(ctx context.Context) (bool, error) {
+	rows, err := c.Query(fmt.Sprintf("SELECT 1 FROM %s LIMIT 1", tableName(c.Table))).Read(ctx)
+	if isNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var row []bigquery.Value
+	err = rows.Next(&row)
+	if err == iterator.Done {
+		return true, nil
+	}
+	return false, err
+}
+
+// LastExecution of sync that succeeded, runs recorded before the status was introduced count as successful
+// and runs recorded before syncs were introduced belong to IssuesSync
+// An empty Execution is returned if there was no successful run yet
+func (c *BigQueryClient) LastExecution(ctx context.Context, sync string) (Execution, error) {
+	query := c.Query(fmt.Sprintf(
+		"SELECT timestamp, checkpoint, position FROM %s WHERE (status IS NULL OR status = '%s') AND %s ORDER BY timestamp DESC LIMIT 1",
+		tableName(c.ExecTable), ExecutionSucceeded, syncFilter(sync),
+	))
+	query.Parameters = []bigquery.QueryParameter{{Name: "sync", Value: sync}}
+
+	rows, err := query.Read(ctx)
+	if isNotFound(err) {
+		return Execution{}, nil
+	}
 	if err != nil {
 		return Execution{}, err
 	}
 
 	var row Execution
-	if err := rows.Next(&row); err != nil {
+	if err := rows.Next(&row); err != nil && err != iterator.Done {
 		return Execution{}, err
 	}
 
 	return row, nil
 }
 
+// RecentExecutions of sync, runs recorded before the status was introduced count as successful
+func (c *BigQueryClient) RecentExecutions(ctx context.Context, sync string, limit int) ([]Execution, error) {
+	query := c.Query(fmt.Sprintf(
+		"SELECT timestamp, IFNULL(status, '%s') AS status, IFNULL(fetched, 0) AS fetched, inserted, IFNULL(rejected, 0) AS rejected FROM %s WHERE %s ORDER BY timestamp DESC LIMIT %d",
+		ExecutionSucceeded, tableName(c.ExecTable), syncFilter(sync), limit,
+	))
+	query.Parameters = []bigquery.QueryParameter{{Name: "sync", Value: sync}}
+
+	rows, err := query.Read(ctx)
+	if isNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var executions []Execution
+	for {
+		var row Execution
+		err := rows.Next(&row)
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		executions = append(executions, row)
+	}
+
+	return executions, nil
+}
+
+// syncFilter of the executions of sync for the query parameter @sync
+// Executions of IssuesSync may have been recorded without sync or with an empty one, see Execution.of
+func syncFilter(sync string) string {
+	if sync == IssuesSync {
+		return "IFNULL(sync, '') IN ('', @sync)"
+	}
+	return "sync = @sync"
+}
+
 func isExists(err error) bool {
 	if gerr, ok := err.(*googleapi.Error); ok {
 		if gerr.Code == http.StatusConflict {
@@ -146,6 +679,12 @@ func isExists(err error) bool {
 	return false
 }
 
+// inStreamingBuffer reports whether a DML statement failed, as it would affect rows in the streaming buffer
+// BigQuery reports it as invalid query, only the message tells it apart from other invalid queries
+func inStreamingBuffer(err error) bool {
+	return strings.Contains(err.Error(), "streaming buffer")
+}
+
 func isNotFound(err error) bool {
 	if gerr, ok := err.(*googleapi.Error); ok {
 		if gerr.Code == http.StatusNotFound {
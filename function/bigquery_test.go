@@ -0,0 +1,93 @@
+package function
+
+import (
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/googleapi"
+)
+
+func TestMergeQueryMatchesOnKey(t *testing.T) {
+	target := &bigquery.Table{ProjectID: "project", DatasetID: "dataset", TableID: "issues"}
+	source := &bigquery.Table{ProjectID: "project", DatasetID: "dataset", TableID: "issues_staging"}
+
+	fields := []FieldSchema{
+		FieldSchema{Name: "issue", Type: "string", Path: "key"},
+		FieldSchema{Name: "status", Type: "string", Path: "fields.status.name"},
+	}
+
+	expect := "MERGE `project.dataset.issues` T USING `project.dataset.issues_staging` S ON T.`issue` = S.`issue` " +
+		"WHEN MATCHED THEN UPDATE SET `issue` = S.`issue`, `status` = S.`status` " +
+		"WHEN NOT MATCHED THEN INSERT (`issue`, `status`) VALUES (S.`issue`, S.`status`)"
+
+	if got := mergeQuery(target, source, "issue", fields); got != expect {
+		t.Fatalf("got invalid query: %v\nexpected: %v", got, expect)
+	}
+}
+
+func TestChunksRespectsRowAndSizeLimits(t *testing.T) {
+	var issues []Issue
+	for i := 0; i < 5; i++ {
+		issues = append(issues, Issue{"issue": "ABC-1"})
+	}
+
+	batches, err := chunks(issues, 2, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 3 || len(batches[0]) != 2 || len(batches[2]) != 1 {
+		t.Fatalf("got invalid chunks by rows: %v", batches)
+	}
+
+	// each issue encodes to 17 bytes, so only two fit into 40 bytes
+	batches, err = chunks(issues, 10, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 3 || len(batches[0]) != 2 || len(batches[2]) != 1 {
+		t.Fatalf("got invalid chunks by size: %v", batches)
+	}
+}
+
+func TestRejectedRowsCountsRowErrors(t *testing.T) {
+	putErr := bigquery.PutMultiError{
+		bigquery.RowInsertionError{RowIndex: 1, Errors: bigquery.MultiError{errors.New("invalid")}},
+		bigquery.RowInsertionError{RowIndex: 1, Errors: bigquery.MultiError{errors.New("invalid")}},
+		bigquery.RowInsertionError{RowIndex: 3, Errors: bigquery.MultiError{errors.New("invalid")}},
+	}
+
+	for _, c := range []struct {
+		err    error
+		expect int
+	}{
+		{nil, 2},
+		{errors.New("timeout"), 2},
+		{putErr, 2},
+	} {
+		if got := rejectedRows(10, 8, c.err); got != c.expect {
+			t.Fatalf("got invalid rejected rows for %v: %v\nexpected: %v", c.err, got, c.expect)
+		}
+	}
+
+	if got := rejectedRows(500, 0, putErr); got != 2 {
+		t.Fatalf("got invalid rejected rows of a chunk: %v\nexpected: %v", got, 2)
+	}
+}
+
+func TestInStreamingBufferDetectsDMLErrors(t *testing.T) {
+	message := "UPDATE or DELETE statement over table project.dataset.issues would affect rows in the streaming buffer, which is not supported"
+	for _, c := range []struct {
+		err    error
+		expect bool
+	}{
+		{&bigquery.Error{Reason: "invalidQuery", Message: message}, true},
+		{&googleapi.Error{Code: 400, Message: message}, true},
+		{&bigquery.Error{Reason: "invalidQuery", Message: "Unrecognized name: deleted_at"}, false},
+		{errors.New("timeout"), false},
+	} {
+		if got := inStreamingBuffer(c.err); got != c.expect {
+			t.Fatalf("got invalid result for %v: %v\nexpected: %v", c.err, got, c.expect)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Checkpoint marks the point in time up to which issues have been synced
+type Checkpoint struct {
+	Timestamp time.Time `json:"timestamp" firestore:"timestamp"`
+	// Position within a source not ordered by time, e.g. the last archived version written by a reprocess run stopped early
+	Position string `json:"position,omitempty" firestore:"position,omitempty"`
+}
+
+// CheckpointStore persists the checkpoint of the last successful run
+type CheckpointStore interface {
+	// Load the last checkpoint, returning an empty Checkpoint if there is none yet
+	Load(ctx context.Context) (Checkpoint, error)
+	// Save the checkpoint of a successful run
+	Save(ctx context.Context, checkpoint Checkpoint) error
+	// Close the clients held by the store
+	Close() error
+}
+
+// NewCheckpointStore for sync from the environment's CHECKPOINT url
+// Supported are `sink` (default), `gs://bucket/path`, `firestore://project/collection/document` and `file://path`
+// The value `bigquery` is kept as an alias for `sink`, as it used to be the only sink
+// Syncs other than IssuesSync store their checkpoint next to it, with the sync's name appended to the path
+func NewCheckpointStore(ctx context.Context, env Environment, sink Sink, sync string) (CheckpointStore, error) {
+	if len(env.Checkpoint) < 1 || env.Checkpoint == "sink" || env.Checkpoint == "bigquery" {
+		log, ok := sink.(ExecutionLog)
+		if !ok {
+			return nil, fmt.Errorf("sink %T does not record executions, please configure CHECKPOINT", sink)
+		}
+		return ExecutionCheckpoints{Log: log, Sync: sync}, nil
+	}
+
+	location, err := url.Parse(env.Checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	path := syncPath(strings.TrimPrefix(location.Path, "/"), sync)
+
+	switch location.Scheme {
+	case "gs":
+		client, err := NewStorageClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return StorageCheckpoints{Object: client.Bucket(location.Host).Object(path), client: client}, nil
+	case "firestore":
+		client, err := firestore.NewClient(ctx, location.Host)
+		if err != nil {
+			return nil, err
+		}
+		return FirestoreCheckpoints{Document: client.Doc(path), client: client}, nil
+	case "file":
+		return FileCheckpoints{Path: syncPath(location.Host+location.Path, sync)}, nil
+	}
+
+	return nil, fmt.Errorf("unknown checkpoint store: %s", env.Checkpoint)
+}
+
+// syncPath appends the sync to path, keeping it's extension
+// The path of IssuesSync stays unchanged, so existing checkpoints keep working
+func syncPath(path, sync string) string {
+	if len(sync) < 1 || sync == IssuesSync {
+		return path
+	}
+
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s_%s%s", strings.TrimSuffix(path, ext), sync, ext)
+}
+
+// ExecutionCheckpoints uses the executions recorded by the sink as checkpoint store
+// Saving is a no-op, as every execution gets recorded anyway
+type ExecutionCheckpoints struct {
+	Log ExecutionLog
+	// Sync whose executions are used
+	Sync string
+}
+
+// Load the checkpoint of the last successful execution, see Execution.Checkpoint
+func (s ExecutionCheckpoints) Load(ctx context.Context) (Checkpoint, error) {
+	exec, err := s.Log.LastExecution(ctx, s.Sync)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+
+	return Checkpoint{Timestamp: exec.checkpoint(), Position: exec.Position}, nil
+}
+
+// Save is a no-op, see ExecutionCheckpoints
+func (s ExecutionCheckpoints) Save(ctx context.Context, checkpoint Checkpoint) error {
+	return nil
+}
+
+// Close is a no-op, the sink providing the executions is closed on it's own
+func (s ExecutionCheckpoints) Close() error {
+	return nil
+}
+
+// StorageCheckpoints stores the checkpoint as JSON object in Google Cloud Storage
+type StorageCheckpoints struct {
+	Object *storage.ObjectHandle
+
+	client *storage.Client
+}
+
+// Load the checkpoint from the object
+func (s StorageCheckpoints) Load(ctx context.Context) (Checkpoint, error) {
+	reader, err := s.Object.NewReader(ctx)
+	if err == storage.ErrObjectNotExist {
+		return Checkpoint{}, nil
+	}
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	defer reader.Close()
+
+	var checkpoint Checkpoint
+	if err := json.NewDecoder(reader).Decode(&checkpoint); err != nil {
+		return Checkpoint{}, err
+	}
+
+	return checkpoint, nil
+}
+
+// Save the checkpoint by overwriting the object
+func (s StorageCheckpoints) Save(ctx context.Context, checkpoint Checkpoint) error {
+	writer := s.Object.NewWriter(ctx)
+	writer.ContentType = "application/json"
+
+	if err := json.NewEncoder(writer).Encode(checkpoint); err != nil {
+		writer.Close()
+		return err
+	}
+
+	return writer.Close()
+}
+
+// Close the storage client, if the store created it
+func (s StorageCheckpoints) Close() error {
+	if s.client == nil {
+		return nil
+	}
+	return s.client.Close()
+}
+
+// FirestoreCheckpoints stores the checkpoint in a Firestore document
+type FirestoreCheckpoints struct {
+	Document *firestore.DocumentRef
+
+	client *firestore.Client
+}
+
+// Load the checkpoint from the document
+func (s FirestoreCheckpoints) Load(ctx context.Context) (Checkpoint, error) {
+	snapshot, err := s.Document.Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return Checkpoint{}, nil
+	}
+	if err != nil {
+		return Checkpoint{}, err
+	}
+
+	var checkpoint Checkpoint
+	if err := snapshot.DataTo(&checkpoint); err != nil {
+		return Checkpoint{}, err
+	}
+
+	return checkpoint, nil
+}
+
+// Save the checkpoint by overwriting the document
+func (s FirestoreCheckpoints) Save(ctx context.Context, checkpoint Checkpoint) error {
+	_, err := s.Document.Set(ctx, checkpoint)
+	return err
+}
+
+// Close the firestore client, if the store created it
+func (s FirestoreCheckpoints) Close() error {
+	if s.client == nil {
+		return nil
+	}
+	return s.client.Close()
+}
+
+// FileCheckpoints stores the checkpoint in a local JSON file, e.g. for running from the CLI
+type FileCheckpoints struct {
+	Path string
+}
+
+// Load the checkpoint from the file
+func (s FileCheckpoints) Load(ctx context.Context) (Checkpoint, error) {
+	raw, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return Checkpoint{}, nil
+	}
+	if err != nil {
+		return Checkpoint{}, err
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(raw, &checkpoint); err != nil {
+		return Checkpoint{}, err
+	}
+
+	return checkpoint, nil
+}
+
+// Save the checkpoint by overwriting the file
+func (s FileCheckpoints) Save(ctx context.Context, checkpoint Checkpoint) error {
+	raw, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(s.Path, raw, 0644)
+}
+
+// Close is a no-op, as the file is only opened while loading or saving
+func (s FileCheckpoints) Close() error {
+	return nil
+}
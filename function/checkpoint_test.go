@@ -0,0 +1,60 @@
+package function
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileCheckpointsRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+
+	store, err := NewCheckpointStore(ctx, Environment{Checkpoint: "file://" + filepath.Join(dir, "checkpoint.json")}, nil, IssuesSync)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	initial, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal("loading missing checkpoint", err)
+	}
+	if !initial.Timestamp.IsZero() {
+		t.Fatalf("got non-empty initial checkpoint: %v", initial)
+	}
+
+	expect := time.Date(2019, 11, 12, 10, 0, 0, 0, time.UTC)
+	if err := store.Save(ctx, Checkpoint{Timestamp: expect}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Timestamp.Equal(expect) {
+		t.Fatalf("got invalid checkpoint: %v\nexpected: %v", got.Timestamp, expect)
+	}
+}
+
+func TestSyncPath(t *testing.T) {
+	for _, c := range []struct {
+		path, sync, expect string
+	}{
+		{"checkpoints/issues.json", IssuesSync, "checkpoints/issues.json"},
+		{"checkpoints/issues.json", WorklogsSync, "checkpoints/issues_worklogs.json"},
+		{"collection/document", WorklogsSync, "collection/document_worklogs"},
+	} {
+		if got := syncPath(c.path, c.sync); got != c.expect {
+			t.Fatalf("got invalid path: %v\nexpected: %v", got, c.expect)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package function
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/seibert-media/golibs/log"
+	"go.uber.org/zap"
+	"golang.org/x/net/html"
+)
+
+// commentSchema of the `<table>_comments` table
+// The issue's key is not part of a comment, it gets added as issueKey before extraction
+// The body in Jira's wiki markup is replaced by the text of the rendered body as bodyText, see commentText
+var commentSchema = []FieldSchema{
+	FieldSchema{Name: "id", Type: "STRING", Path: "id", Required: true},
+	FieldSchema{Name: "issue", Type: "STRING", Path: "issueKey", Required: true},
+	FieldSchema{Name: "author", Type: "STRING", Path: "author.displayName"},
+	FieldSchema{Name: "created", Type: "TIMESTAMP", Path: "created"},
+	FieldSchema{Name: "updated", Type: "TIMESTAMP", Path: "updated"},
+	FieldSchema{Name: "body", Type: "STRING", Path: "bodyText"},
+	FieldSchema{Name: "visibility", Type: "STRING", Path: "visibility.value"},
+}
+
+// maxComments is the amount of comments requested per page when paginating an issue's comments
+const maxComments = 100
+
+// SyncComments writes all comments of the issues updated since the last run into the `<table>_comments` table
+// In a dry run, the rows are printed to stdout instead and nothing gets created, written or recorded
+func SyncComments(ctx context.Context, env Environment, opts RunOptions) (err error) {
+	exec := Execution{Timestamp: time.Now().UTC(), Version: env.Version, Sync: CommentsSync, SchemaHash: SchemaHash(commentSchema)}
+	env = env.dimension("comments", "id")
+
+	sink, checkpoints, err := openSink(ctx, env, opts, CommentsSync)
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+	defer checkpoints.Close()
+	defer recordExecution(ctx, sink, &exec, &err)
+
+	if err := sink.Prepare(ctx, commentSchema); err != nil {
+		log.From(ctx).Error("preparing sink", zap.Error(err))
+		return err
+	}
+
+	log.From(ctx).Debug("loading checkpoint")
+	last, err := checkpoints.Load(ctx)
+	if err != nil {
+		log.From(ctx).Error("loading checkpoint", zap.Error(err))
+		return err
+	}
+
+	log.From(ctx).Debug("creating jira client")
+	jira, err := NewJiraClient(ctx, env)
+	if err != nil {
+		log.From(ctx).Error("creating jira client", zap.Error(err))
+		return err
+	}
+
+	// adding or editing a comment changes the issue's updated time, so the issue query finds them
+	exec.JQL, err = jira.Query(last.Timestamp)
+	if err != nil {
+		log.From(ctx).Error("building query", zap.Error(err))
+		return err
+	}
+
+	log.From(ctx).Info("fetching issues", zap.String("jql", exec.JQL))
+	issues, err := jira.CommentedIssues(ctx, exec.JQL)
+	if err != nil {
+		log.From(ctx).Error("fetching issues", zap.Error(err))
+		return err
+	}
+
+	policy := env.userPolicy()
+
+	var rows []Issue
+	for _, issue := range issues {
+		comments, err := jira.Comments(ctx, issue)
+		if err != nil {
+			log.From(ctx).Error("fetching comments", zap.Any("issue", issue["key"]), zap.Error(err))
+			return err
+		}
+		policy.Apply(comments)
+
+		for _, comment := range comments {
+			comment["issueKey"] = issue["key"]
+			comment["bodyText"] = commentText(comment)
+
+			row, err := FieldExtractor(commentSchema).extractRow(comment)
+			if err != nil {
+				log.From(ctx).Error("converting comment", zap.Error(err))
+				return err
+			}
+			row[insertIDKey] = fmt.Sprintf("%v-%v", comment["id"], comment["updated"])
+			rows = append(rows, row)
+		}
+	}
+	rows = uniqueRows(rows, "id")
+	exec.Fetched = len(rows)
+
+	log.From(ctx).Info("inserting")
+	exec.Inserted, err = sink.Write(ctx, rows)
+	exec.Rejected = rejectedRows(len(rows), exec.Inserted, err)
+	if err != nil {
+		log.From(ctx).Error("inserting", zap.Error(err))
+		return err
+	}
+
+	log.From(ctx).Debug("saving checkpoint")
+	if err := checkpoints.Save(ctx, Checkpoint{Timestamp: exec.Timestamp}); err != nil {
+		log.From(ctx).Error("saving checkpoint", zap.Error(err))
+		return err
+	}
+
+	log.From(ctx).Info("inserted", zap.Int("comments", exec.Inserted))
+	return nil
+}
+
+// CommentedIssues matching jql, only requesting their comments, which are also rendered as HTML
+func (c JiraClient) CommentedIssues(ctx context.Context, jql string) ([]Issue, error) {
+	return c.Search(ctx, jql, &jira.SearchOptions{MaxResults: 100, Fields: []string{"comment"}, Expand: "renderedFields"})
+}
+
+type commentPage struct {
+	StartAt    int     `json:"startAt"`
+	MaxResults int     `json:"maxResults"`
+	Total      int     `json:"total"`
+	Comments   []Issue `json:"comments"`
+}
+
+// Comments of an issue returned by CommentedIssues
+// Search responses only include the first page of comments, all comments get requested if the issue has more
+func (c JiraClient) Comments(ctx context.Context, issue Issue) ([]Issue, error) {
+	var embedded commentPage
+	if fields, ok := issue["fields"].(map[string]interface{}); ok {
+		if page, ok := fields["comment"].(map[string]interface{}); ok {
+			embedded.Total = toInt(page["total"])
+			comments, _ := page["comments"].([]interface{})
+			for _, comment := range comments {
+				if comment, ok := comment.(map[string]interface{}); ok {
+					embedded.Comments = append(embedded.Comments, comment)
+				}
+			}
+		}
+	}
+
+	if len(embedded.Comments) >= embedded.Total {
+		return renderedComments(issue, embedded.Comments), nil
+	}
+
+	comments := []Issue{}
+	for len(comments) < embedded.Total {
+		log.From(ctx).Debug("reading comments", zap.Any("issue", issue["key"]), zap.Int("current", len(comments)), zap.Int("total", embedded.Total))
+
+		req, err := c.NewRequest("GET", fmt.Sprintf("rest/api/2/issue/%v/comment?startAt=%d&maxResults=%d&expand=renderedBody", issue["key"], len(comments), maxComments), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var page commentPage
+		resp, err := c.Do(req, &page)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("reading comments: status %v", resp.StatusCode)
+		}
+
+		// comments deleted in the meantime reduce the total
+		if len(page.Comments) < 1 {
+			break
+		}
+		comments = append(comments, page.Comments...)
+		embedded.Total = page.Total
+	}
+
+	return comments, nil
+}
+
+// renderedComments adds the rendered body of the issue's renderedFields to the embedded comments as renderedBody,
+// like it is returned when requesting the comments separately
+func renderedComments(issue Issue, comments []Issue) []Issue {
+	rendered := make(map[interface{}]interface{})
+	if fields, ok := issue["renderedFields"].(map[string]interface{}); ok {
+		if page, ok := fields["comment"].(map[string]interface{}); ok {
+			list, _ := page["comments"].([]interface{})
+			for _, comment := range list {
+				if comment, ok := comment.(map[string]interface{}); ok {
+					rendered[comment["id"]] = comment["body"]
+				}
+			}
+		}
+	}
+
+	for _, comment := range comments {
+		if body, ok := rendered[comment["id"]]; ok {
+			comment["renderedBody"] = body
+		}
+	}
+	return comments
+}
+
+// commentText of the comment's renderedBody without HTML, falling back to the body in wiki markup if it was not rendered
+func commentText(comment Issue) string {
+	rendered, ok := comment["renderedBody"].(string)
+	if !ok {
+		body, _ := comment["body"].(string)
+		return body
+	}
+
+	return htmlText(rendered)
+}
+
+// lineElements of HTML, which start a new line of the text
+var lineElements = map[string]bool{"br": true, "li": true, "tr": true}
+
+// paragraphElements of HTML, which are separated from the surrounding text by an empty line
+var paragraphElements = map[string]bool{
+	"p": true, "div": true, "pre": true, "blockquote": true, "ul": true, "ol": true, "table": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+// htmlText of an HTML fragment, whitespace is collapsed like in a browser but lines and paragraphs are kept
+func htmlText(fragment string) string {
+	var text strings.Builder
+	tokenizer := html.NewTokenizer(strings.NewReader(fragment))
+	for {
+		token := tokenizer.Next()
+		switch token {
+		case html.ErrorToken:
+			lines := strings.Split(text.String(), "\n")
+			for i, line := range lines {
+				lines[i] = strings.TrimSpace(line)
+			}
+			return strings.TrimSpace(emptyLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+		case html.TextToken:
+			text.WriteString(whitespace.ReplaceAllString(string(tokenizer.Text()), " "))
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			name, _ := tokenizer.TagName()
+			switch {
+			case paragraphElements[string(name)]:
+				text.WriteString("\n\n")
+			case lineElements[string(name)] && token != html.EndTagToken:
+				text.WriteString("\n")
+			}
+		}
+	}
+}
+
+var (
+	whitespace = regexp.MustCompile(`\s+`)
+	emptyLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// toInt converts a JSON number to int
+func toInt(value interface{}) int {
+	number, _ := value.(float64)
+	return int(number)
+}
@@ -0,0 +1,89 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	jira "github.com/andygrunwald/go-jira"
+)
+
+func TestCommentsUsesEmbeddedComments(t *testing.T) {
+	var issue Issue
+	if err := json.Unmarshal([]byte(`{
+		"key": "ABC-1",
+		"fields": {"comment": {"startAt": 0, "maxResults": 2, "total": 2, "comments": [{"id": "1", "body": "*bold*"}, {"id": "2"}]}},
+		"renderedFields": {"comment": {"comments": [{"id": "1", "body": "<p><b>bold</b></p>"}]}}
+	}`), &issue); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := JiraClient{}.Comments(context.Background(), issue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[1]["id"] != "2" {
+		t.Fatalf("got invalid comments: %v\nexpected: %v", got, "comments 1 and 2")
+	}
+	if text := commentText(got[0]); text != "bold" {
+		t.Fatalf("got invalid text: %q\nexpected: %q", text, "bold")
+	}
+}
+
+func TestHTMLText(t *testing.T) {
+	for _, c := range []struct {
+		html   string
+		expect string
+	}{
+		{"plain", "plain"},
+		{"<p>Hello <b>World</b> &amp; <a href=\"https://example.com\">friends</a></p>", "Hello World & friends"},
+		{"<p>first<br/>\nsecond</p>\n\n<p>next</p>", "first\nsecond\n\nnext"},
+		{"<ul>\n<li>one</li>\n<li>two</li>\n</ul>", "one\ntwo"},
+	} {
+		if got := htmlText(c.html); got != c.expect {
+			t.Fatalf("got invalid text of %q: %q\nexpected: %q", c.html, got, c.expect)
+		}
+	}
+}
+
+func TestCommentsPaginatesTruncatedComments(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/api/2/issue/ABC-1/comment" || r.URL.Query().Get("expand") != "renderedBody" {
+			http.NotFound(w, r)
+			return
+		}
+
+		start, _ := strconv.Atoi(r.URL.Query().Get("startAt"))
+		page := commentPage{StartAt: start, MaxResults: 2, Total: 5}
+		for i := start; i < start+2 && i < page.Total; i++ {
+			page.Comments = append(page.Comments, Issue{"id": fmt.Sprint(i)})
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer server.Close()
+
+	client, err := jira.NewClient(nil, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var issue Issue
+	if err := json.Unmarshal([]byte(`{
+		"key": "ABC-1",
+		"fields": {"comment": {"startAt": 0, "maxResults": 1, "total": 5, "comments": [{"id": "0"}]}}
+	}`), &issue); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := JiraClient{Client: client}.Comments(context.Background(), issue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 5 || got[4]["id"] != "4" {
+		t.Fatalf("got invalid comments: %v\nexpected: %v", got, "comments 0 to 4")
+	}
+}
@@ -0,0 +1,133 @@
+package function
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/seibert-media/golibs/log"
+	"go.uber.org/zap"
+	"google.golang.org/api/option"
+	pubsub "google.golang.org/api/pubsub/v1"
+)
+
+// continuationMargin left before the run timeout, to write the fetched issues and publish the continuation
+const continuationMargin = 2 * time.Minute
+
+// ErrDeadline is returned along with the issues fetched so far, if a search reached the client's deadline
+var ErrDeadline = errors.New("deadline reached")
+
+// runDeadline after which a run started at start stops fetching and continues in a follow-up run
+// This is the earlier of the context's deadline and the environment's run timeout, minus a margin
+// The zero time is returned if runs can not be continued, which is the case without a topic or in a dry run
+func runDeadline(ctx context.Context, env Environment, opts RunOptions, start time.Time) time.Time {
+	if len(env.Topic) < 1 || opts.DryRun {
+		return time.Time{}
+	}
+
+	var deadline time.Time
+	if env.RunTimeout > 0 {
+		deadline = start.Add(env.RunTimeout)
+	}
+	if ctxDeadline, ok := ctx.Deadline(); ok && (deadline.IsZero() || ctxDeadline.Before(deadline)) {
+		deadline = ctxDeadline
+	}
+	if deadline.IsZero() {
+		return deadline
+	}
+
+	return deadline.Add(-continuationMargin)
+}
+
+// stopKey is the context key of the channel closed once a run has to stop early, see withStop
+type stopKey struct{}
+
+// withStop returns a context stopping the run once stop is closed, e.g. when the daemon shuts down
+// A stopped run finishes like one reaching it's deadline, it writes the issues fetched so far and saves it's checkpoint
+func withStop(ctx context.Context, stop <-chan struct{}) context.Context {
+	return context.WithValue(ctx, stopKey{}, stop)
+}
+
+// deadlineReached reports whether the deadline is set and has passed or the run of ctx has been stopped
+func deadlineReached(ctx context.Context, deadline time.Time) bool {
+	if stop, ok := ctx.Value(stopKey{}).(<-chan struct{}); ok {
+		select {
+		case <-stop:
+			return true
+		default:
+		}
+	}
+
+	return !deadline.IsZero() && time.Now().After(deadline)
+}
+
+// cursor of a truncated run, which is the update time of the last fetched issue
+// The issues have to be ordered by their update time
+func cursor(issues []Issue) (time.Time, error) {
+	if len(issues) < 1 {
+		return time.Time{}, errors.New("missing cursor: no issues fetched")
+	}
+
+	last := issues[len(issues)-1]
+	fields, _ := last["fields"].(map[string]interface{})
+	updated, err := time.Parse(jiraTimestamp, fmt.Sprint(fields["updated"]))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("missing cursor: %v: updated: %v", last["key"], err)
+	}
+
+	return updated.UTC(), nil
+}
+
+// advances reports whether a query starting at the cursor skips issues compared to one starting at from
+// Jira queries have a precision of minutes, so the cursor has to be in a later minute
+func advances(cursor, from time.Time) bool {
+	return cursor.Truncate(time.Minute).After(from.Truncate(time.Minute))
+}
+
+// NewPubSubService for publishing messages
+// If PUBSUB_EMULATOR_HOST is set, all requests are sent to the unauthenticated emulator running there
+func NewPubSubService(ctx context.Context) (*pubsub.Service, error) {
+	if host := os.Getenv("PUBSUB_EMULATOR_HOST"); len(host) > 0 {
+		return pubsub.NewService(ctx,
+			option.WithEndpoint(fmt.Sprintf("http://%s/", host)),
+			option.WithoutAuthentication(),
+		)
+	}
+
+	return pubsub.NewService(ctx)
+}
+
+// Continue a run in a follow-up run with opts, by publishing them to the environment's topic
+// Without topic the run was stopped by the daemon, whose next scheduled run continues from the saved checkpoint
+func Continue(ctx context.Context, env Environment, opts RunOptions) error {
+	if len(env.Topic) < 1 {
+		log.From(ctx).Info("stopped early, continuing with the next run")
+		return nil
+	}
+
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return err
+	}
+
+	log.From(ctx).Debug("creating pubsub service")
+	svc, err := NewPubSubService(ctx)
+	if err != nil {
+		log.From(ctx).Error("creating pubsub service", zap.Error(err))
+		return err
+	}
+
+	log.From(ctx).Info("publishing continuation", zap.String("topic", env.Topic), zap.ByteString("options", data))
+	if _, err := svc.Projects.Topics.Publish(env.Topic, &pubsub.PublishRequest{
+		Messages: []*pubsub.PubsubMessage{{Data: base64.StdEncoding.EncodeToString(data)}},
+	}).Context(ctx).Do(); err != nil {
+		log.From(ctx).Error("publishing continuation", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,266 @@
+package function
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pagedJira serves the issues ABC-1 to ABC-<total> one per page, updated an hour apart, to a user in UTC
+func pagedJira(total int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/rest/api/2/myself" {
+			w.Write([]byte(`{"timeZone":"UTC"}`))
+			return
+		}
+		if r.URL.Path != "/rest/api/2/search" {
+			http.NotFound(w, r)
+			return
+		}
+
+		var startAt int
+		fmt.Sscan(r.URL.Query().Get("startAt"), &startAt)
+		updated := time.Date(2019, 11, 12, startAt, 0, 0, 0, time.UTC).Format(jiraTimestamp)
+		fmt.Fprintf(w, `{"startAt":%d,"maxResults":1,"total":%d,"issues":[{"id":"%d","key":"ABC-%d","fields":{"updated":%q}}]}`, startAt, total, startAt+1, startAt+1, updated)
+	})
+}
+
+func TestSearchDeadline(t *testing.T) {
+	server := httptest.NewServer(pagedJira(3))
+	defer server.Close()
+
+	ctx := context.Background()
+	jira, err := NewJiraClient(ctx, Environment{JiraAuthSecret: fmt.Sprintf(`{"url":%q}`, server.URL), JiraProject: "ABC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issues, err := jira.Issues(ctx, "project = ABC", 1)
+	if err != nil || len(issues) != 2 || issues[0]["key"] != "ABC-2" {
+		t.Fatalf("got invalid issues: %v, %v\nexpected: %v", issues, err, "ABC-2 and ABC-3")
+	}
+
+	// the first page is always requested, so every run makes progress
+	jira.Deadline = time.Now().Add(-time.Minute)
+	issues, err = jira.Issues(ctx, "project = ABC", 0)
+	if err != ErrDeadline || len(issues) != 1 {
+		t.Fatalf("got invalid issues: %v, %v\nexpected: %v", issues, err, "ABC-1 with ErrDeadline")
+	}
+}
+
+func TestRunDeadline(t *testing.T) {
+	start := time.Date(2019, 11, 12, 10, 0, 0, 0, time.UTC)
+	env := Environment{Topic: "projects/p/topics/t", RunTimeout: 9 * time.Minute}
+
+	if got, expect := runDeadline(context.Background(), env, RunOptions{}, start), start.Add(7*time.Minute); !got.Equal(expect) {
+		t.Fatalf("got invalid deadline: %v\nexpected: %v", got, expect)
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), start.Add(5*time.Minute))
+	defer cancel()
+	if got, expect := runDeadline(ctx, env, RunOptions{}, start), start.Add(3*time.Minute); !got.Equal(expect) {
+		t.Fatalf("got invalid deadline: %v\nexpected: %v", got, expect)
+	}
+
+	if got := runDeadline(ctx, env, RunOptions{DryRun: true}, start); !got.IsZero() {
+		t.Fatalf("got invalid deadline: %v\nexpected: %v", got, "none in a dry run")
+	}
+	if got := runDeadline(ctx, Environment{RunTimeout: env.RunTimeout}, RunOptions{}, start); !got.IsZero() {
+		t.Fatalf("got invalid deadline: %v\nexpected: %v", got, "none without topic")
+	}
+}
+
+func TestContinuation(t *testing.T) {
+	now := time.Date(2019, 11, 12, 10, 0, 0, 0, time.UTC)
+	cursor := time.Date(2019, 11, 12, 8, 30, 0, 0, time.UTC)
+	for _, c := range []struct {
+		opts   RunOptions
+		expect RunOptions
+	}{
+		{RunOptions{}, RunOptions{}},
+		{RunOptions{FullResync: true}, RunOptions{}},
+		{RunOptions{JQL: "key = ABC-1", Cursor: "2019-11-12T08:00:00Z"}, RunOptions{JQL: "key = ABC-1", Cursor: "2019-11-12T08:30:00Z"}},
+		{RunOptions{Since: "2019-01-01"}, RunOptions{Since: "2019-01-01", Until: "2019-11-12T10:00:00Z", Cursor: "2019-11-12T08:30:00Z"}},
+	} {
+		if got := continuation(c.opts, cursor, now); !reflect.DeepEqual(got, c.expect) {
+			t.Fatalf("got invalid continuation of %+v: %+v\nexpected: %+v", c.opts, got, c.expect)
+		}
+	}
+}
+
+func TestCursorQuery(t *testing.T) {
+	server := httptest.NewServer(pagedJira(0))
+	defer server.Close()
+
+	jira, err := NewJiraClient(context.Background(), Environment{JiraAuthSecret: fmt.Sprintf(`{"url":%q}`, server.URL), JiraProject: "ABC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cursor := time.Date(2019, 11, 12, 8, 30, 15, 0, time.UTC)
+	for _, c := range []struct {
+		jql    string
+		cursor time.Time
+		expect string
+	}{
+		{"key = ABC-1", time.Time{}, "key = ABC-1 ORDER BY updated ASC, key ASC"},
+		{"project = ABC order by created DESC", cursor, `(project = ABC) AND updated >= "2019-11-12 08:30" ORDER BY updated ASC, key ASC`},
+		{`summary ~ "order by date"`, cursor, `(summary ~ "order by date") AND updated >= "2019-11-12 08:30" ORDER BY updated ASC, key ASC`},
+	} {
+		got, err := jira.CursorQuery(c.jql, c.cursor)
+		if err != nil || got != c.expect {
+			t.Fatalf("got invalid query for %s: %v, %v\nexpected: %v", c.jql, got, err, c.expect)
+		}
+	}
+}
+
+// fakePubSub records the run options published to its topics, until the returned function closes it
+func fakePubSub() (*[]RunOptions, func()) {
+	var published []RunOptions
+	pubsub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/projects/p/topics/t:publish" {
+			http.NotFound(w, r)
+			return
+		}
+
+		var req struct {
+			Messages []struct {
+				Data string `json:"data"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Messages) != 1 {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		data, _ := base64.StdEncoding.DecodeString(req.Messages[0].Data)
+		opts, err := ParseRunOptions(data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		published = append(published, opts)
+		w.Write([]byte(`{"messageIds":["1"]}`))
+	}))
+	os.Setenv("PUBSUB_EMULATOR_HOST", strings.TrimPrefix(pubsub.URL, "http://"))
+
+	return &published, func() {
+		os.Unsetenv("PUBSUB_EMULATOR_HOST")
+		pubsub.Close()
+	}
+}
+
+func TestTruncatedRunContinues(t *testing.T) {
+	published, closePubSub := fakePubSub()
+	defer closePubSub()
+
+	jira := httptest.NewServer(pagedJira(3))
+	defer jira.Close()
+
+	dir, err := ioutil.TempDir("", "continuation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	auth, err := json.Marshal(JiraAuth{URL: jira.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := Environment{
+		JiraAuthSecret: string(auth),
+		JiraProject:    "ABC",
+		Sink:           NDJSONSink,
+		SinkPath:       dir,
+		SchemaPath:     filepath.Join(dir, "schema.json"),
+		Topic:          "projects/p/topics/t",
+		// the deadline has passed as soon as the run starts
+		RunTimeout: time.Second,
+	}
+	if err := ioutil.WriteFile(env.SchemaPath, []byte(`[{"name":"issue","type":"STRING","path":"key"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := InsertIssues(ctx, env, RunOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := []RunOptions{{}}; !reflect.DeepEqual(*published, expect) {
+		t.Fatalf("got invalid continuations: %+v\nexpected: %+v", *published, expect)
+	}
+
+	sink := &FileSink{Dir: dir, Table: "issues", Format: NDJSONSink}
+	last, err := sink.LastExecution(ctx, IssuesSync)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.Fetched != 1 || last.Inserted != 1 {
+		t.Fatalf("got invalid execution: %+v\nexpected: %v", last, "1 fetched and inserted issue")
+	}
+
+	checkpoint, err := ExecutionCheckpoints{Log: sink, Sync: IssuesSync}.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := time.Date(2019, 11, 12, 0, 0, 0, 0, time.UTC); !checkpoint.Timestamp.Equal(expect) {
+		t.Fatalf("got invalid checkpoint: %v\nexpected: %v", checkpoint.Timestamp, expect)
+	}
+}
+
+func TestTruncatedAdhocRunContinuesFromCursor(t *testing.T) {
+	published, closePubSub := fakePubSub()
+	defer closePubSub()
+
+	jira := httptest.NewServer(pagedJira(3))
+	defer jira.Close()
+
+	dir, err := ioutil.TempDir("", "continuation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	auth, err := json.Marshal(JiraAuth{URL: jira.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := Environment{
+		JiraAuthSecret: string(auth),
+		JiraProject:    "ABC",
+		Sink:           NDJSONSink,
+		SinkPath:       dir,
+		SchemaPath:     filepath.Join(dir, "schema.json"),
+		Topic:          "projects/p/topics/t",
+		// the deadline has passed as soon as the run starts
+		RunTimeout: time.Second,
+	}
+	if err := ioutil.WriteFile(env.SchemaPath, []byte(`[{"name":"issue","type":"STRING","path":"key"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := RunOptions{JQL: "project = ABC"}
+	if err := InsertIssues(ctx, env, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	opts.Cursor = "2019-11-12T00:00:00Z"
+	if expect := []RunOptions{opts}; !reflect.DeepEqual(*published, expect) {
+		t.Fatalf("got invalid continuations: %+v\nexpected: %+v", *published, expect)
+	}
+
+	// the fake returns the same issue again, so the cursor does not move and the continuation stops
+	if err := InsertIssues(ctx, env, opts); err == nil || len(*published) != 1 {
+		t.Fatalf("got invalid continuation: %v, %+v\nexpected: %v", err, *published, "an error without continuation")
+	}
+}
@@ -0,0 +1,177 @@
+package function
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/seibert-media/golibs/log"
+	"go.uber.org/zap"
+)
+
+// Job of a Daemon, running a sync with the options on a schedule
+type Job struct {
+	Schedule Schedule
+	Options  RunOptions
+}
+
+// Daemon runs the syncs of it's jobs on their schedules in a long-running process, as alternative to Cloud Functions
+// Runs never overlap, jobs which are due at the same time run one after another
+type Daemon struct {
+	Env  Environment
+	Jobs []Job
+	// ShutdownTimeout of a run in progress once the daemon stops, after which the run gets canceled
+	ShutdownTimeout time.Duration
+
+	// ready is 1 while the daemon is scheduling runs, it is accessed atomically
+	ready int32
+}
+
+// Run the jobs on their schedules until ctx is done
+// A run in progress stops fetching with ctx, see run, Run returns once it finished
+func (d *Daemon) Run(ctx context.Context) error {
+	if len(d.Jobs) < 1 {
+		return errors.New("no jobs to schedule")
+	}
+
+	atomic.StoreInt32(&d.ready, 1)
+	defer atomic.StoreInt32(&d.ready, 0)
+
+	// the daemon is no longer ready as soon as it is stopping, even if a run is still in progress
+	stopping := make(chan struct{})
+	defer close(stopping)
+	go func() {
+		select {
+		case <-ctx.Done():
+			atomic.StoreInt32(&d.ready, 0)
+		case <-stopping:
+		}
+	}()
+
+	for {
+		next, due := d.next(time.Now())
+		if next.IsZero() {
+			return errors.New("no job is scheduled within the next five years")
+		}
+
+		log.From(ctx).Debug("waiting for next run", zap.Time("next", next), zap.Int("jobs", len(due)))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			log.From(ctx).Info("stopped scheduling")
+			return nil
+		case <-timer.C:
+		}
+
+		for _, job := range due {
+			if ctx.Err() != nil {
+				log.From(ctx).Info("stopped scheduling")
+				return nil
+			}
+			d.run(ctx, job)
+		}
+	}
+}
+
+// next time any job is due after now and the jobs due then
+func (d *Daemon) next(now time.Time) (time.Time, []Job) {
+	var next time.Time
+	var due []Job
+	for _, job := range d.Jobs {
+		at := job.Schedule.Next(now)
+		switch {
+		case at.IsZero():
+		case next.IsZero() || at.Before(next):
+			next, due = at, []Job{job}
+		case at.Equal(next):
+			due = append(due, job)
+		}
+	}
+
+	return next, due
+}
+
+// run the job's sync, failed runs are logged and recorded in the executions like any other run
+// Once ctx is done, the run stops after the current page, writes it and saves it's checkpoint
+// It gets canceled, if it does not finish within the ShutdownTimeout
+func (d *Daemon) run(ctx context.Context, job Job) {
+	runCtx, cancel := context.WithCancel(withStop(detachedContext{ctx}, ctx.Done()))
+	defer cancel()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-runCtx.Done():
+			return
+		}
+
+		timer := time.NewTimer(d.ShutdownTimeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			log.From(ctx).Warn("canceling run", zap.String("sync", job.Options.Sync), zap.Duration("timeout", d.ShutdownTimeout))
+			cancel()
+		case <-runCtx.Done():
+		}
+	}()
+
+	log.From(ctx).Info("running job", zap.String("sync", job.Options.Sync))
+	summary, err := RunSummary(runCtx, d.Env, job.Options)
+	if err != nil {
+		log.From(ctx).Error("running job", zap.String("sync", summary.Sync), zap.Error(err))
+		return
+	}
+
+	log.From(ctx).Info("finished job",
+		zap.String("sync", summary.Sync),
+		zap.Int("fetched", summary.Fetched),
+		zap.Int("inserted", summary.Inserted),
+		zap.Int("rejected", summary.Rejected),
+		zap.Int("deleted", summary.Deleted),
+		zap.Float64("duration", summary.Duration),
+	)
+}
+
+// Ready reports whether the daemon is scheduling runs
+func (d *Daemon) Ready() bool {
+	return atomic.LoadInt32(&d.ready) == 1
+}
+
+// Handler serving the probes and metrics of the daemon
+// `/healthz` responds with status 200 as long as the process serves requests,
+// `/readyz` with status 503 before the daemon started and once it is stopping
+// `/metrics` serves the Metrics of the runs and the runtime metrics of the process for Prometheus
+func (d *Daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(prometheus.Gatherers{prometheus.DefaultGatherer, Metrics}, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !d.Ready() {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "unavailable"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+
+	return mux
+}
+
+// detachedContext keeps the values of a context, e.g. it's logger, but is never canceled with it
+type detachedContext struct {
+	context.Context
+}
+
+// Deadline of a detached context is never set
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+// Done of a detached context is never closed
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+// Err of a detached context is always nil
+func (detachedContext) Err() error { return nil }
@@ -0,0 +1,198 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDaemonNext(t *testing.T) {
+	daily, err := ParseSchedule("0 0 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hourly, err := ParseSchedule("0 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	daemon := &Daemon{Jobs: []Job{
+		{daily, RunOptions{}},
+		{hourly, RunOptions{Sync: WorklogsSync}},
+		{daily, RunOptions{Sync: ReconcileSync}},
+	}}
+
+	next, due := daemon.next(time.Date(2019, 11, 12, 10, 7, 0, 0, time.UTC))
+	if expect := time.Date(2019, 11, 12, 11, 0, 0, 0, time.UTC); !next.Equal(expect) || len(due) != 1 {
+		t.Fatalf("got invalid next run: %v with %d jobs\nexpected: %v with 1 job", next, len(due), expect)
+	}
+
+	// jobs due at the same time run in their order
+	next, due = daemon.next(time.Date(2019, 11, 12, 23, 30, 0, 0, time.UTC))
+	if expect := []Job{daemon.Jobs[0], daemon.Jobs[1], daemon.Jobs[2]}; !reflect.DeepEqual(due, expect) {
+		t.Fatalf("got invalid due jobs at %v: %+v\nexpected: %+v", next, due, expect)
+	}
+}
+
+func TestDaemonProbes(t *testing.T) {
+	schedule, err := ParseSchedule("0 0 1 1 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	daemon := &Daemon{Jobs: []Job{{schedule, RunOptions{}}}}
+
+	server := httptest.NewServer(daemon.Handler())
+	defer server.Close()
+
+	probe := func(path string) int {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if got := probe("/readyz"); got != http.StatusServiceUnavailable {
+		t.Fatalf("got invalid status before start: %v\nexpected: %v", got, http.StatusServiceUnavailable)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- daemon.Run(ctx) }()
+
+	for !daemon.Ready() {
+		time.Sleep(time.Millisecond)
+	}
+	if got := probe("/readyz"); got != http.StatusOK {
+		t.Fatalf("got invalid status while running: %v\nexpected: %v", got, http.StatusOK)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := probe("/readyz"); got != http.StatusServiceUnavailable {
+		t.Fatalf("got invalid status after stop: %v\nexpected: %v", got, http.StatusServiceUnavailable)
+	}
+	if got := probe("/healthz"); got != http.StatusOK {
+		t.Fatalf("got invalid health status: %v\nexpected: %v", got, http.StatusOK)
+	}
+}
+
+func TestDetachedContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), executionsKey{}, "value"))
+	cancel()
+
+	detached := detachedContext{ctx}
+	if detached.Err() != nil || detached.Value(executionsKey{}) != "value" {
+		t.Fatalf("got invalid detached context: %v, %v\nexpected: %v", detached.Err(), detached.Value(executionsKey{}), "no error and the value")
+	}
+}
+
+// stoppingDaemon with a file sink in dir, whose Jira stops the daemon by canceling ctx on the first search and then serves the handler
+func stoppingDaemon(t *testing.T, dir string, cancel context.CancelFunc, handler http.Handler) (*Daemon, func()) {
+	jira := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/rest/api/2/search" {
+			cancel()
+		}
+		handler.ServeHTTP(w, r)
+	}))
+
+	auth, err := json.Marshal(JiraAuth{URL: jira.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := Environment{
+		JiraAuthSecret: string(auth),
+		JiraProject:    "ABC",
+		Sink:           NDJSONSink,
+		SinkPath:       dir,
+		SchemaPath:     filepath.Join(dir, "schema.json"),
+	}
+	if err := ioutil.WriteFile(env.SchemaPath, []byte(`[{"name":"issue","type":"STRING","path":"key"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return &Daemon{Env: env, ShutdownTimeout: time.Minute}, jira.Close
+}
+
+func TestDaemonStopsRunAfterCurrentPage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	daemon, closeJira := stoppingDaemon(t, dir, cancel, pagedJira(3))
+	defer closeJira()
+
+	daemon.run(ctx, Job{})
+
+	sink := &FileSink{Dir: dir, Table: "issues", Format: NDJSONSink}
+	last, err := sink.LastExecution(ctx, IssuesSync)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.Fetched != 1 || last.Inserted != 1 {
+		t.Fatalf("got invalid execution: %+v\nexpected: %v", last, "1 fetched and inserted issue")
+	}
+
+	checkpoint, err := ExecutionCheckpoints{Log: sink, Sync: IssuesSync}.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := time.Date(2019, 11, 12, 0, 0, 0, 0, time.UTC); !checkpoint.Timestamp.Equal(expect) {
+		t.Fatalf("got invalid checkpoint: %v\nexpected: %v", checkpoint.Timestamp, expect)
+	}
+}
+
+func TestDaemonCancelsRunAfterShutdownTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// the first page never arrives, until the request gets canceled
+	daemon, closeJira := stoppingDaemon(t, dir, cancel, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/rest/api/2/myself" {
+			w.Write([]byte(`{"timeZone":"UTC"}`))
+			return
+		}
+		<-r.Context().Done()
+	}))
+	defer closeJira()
+	daemon.ShutdownTimeout = 10 * time.Millisecond
+
+	done := make(chan struct{})
+	go func() {
+		daemon.run(ctx, Job{})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("got invalid run: %v\nexpected: %v", "still running", "canceled after the shutdown timeout")
+	}
+
+	last, err := (&FileSink{Dir: dir, Table: "issues", Format: NDJSONSink}).RecentExecutions(ctx, IssuesSync, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(last) != 1 || last[0].Status != ExecutionFailed {
+		t.Fatalf("got invalid executions: %+v\nexpected: %v", last, "the failed run")
+	}
+}
@@ -0,0 +1,103 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	// TableFormat prints rows as aligned text table
+	TableFormat = "table"
+	// NDJSONFormat prints rows as newline-delimited JSON
+	NDJSONFormat = "ndjson"
+)
+
+// DryRunSink prints the DDL and rows it receives instead of storing them
+// It does not create anything and does not record executions
+type DryRunSink struct {
+	Out    io.Writer
+	Format string
+	Table  string
+	// Mode is the BigQueryMode of the table, which changes it's DDL
+	Mode string
+
+	// source is the sink replaced by the dry run, which still provides the checkpoints and gets closed with it
+	source Sink
+	fields []FieldSchema
+}
+
+// Prepare prints the DDL of the table
+func (s *DryRunSink) Prepare(ctx context.Context, fields []FieldSchema) error {
+	s.fields = fields
+
+	_, err := fmt.Fprintf(s.Out, "%s;\n\n", BigQueryDDL(s.Table, fields, s.Mode))
+	return err
+}
+
+// Write prints the rows in the sink's Format
+func (s *DryRunSink) Write(ctx context.Context, rows []Issue) (int, error) {
+	if s.Format == NDJSONFormat {
+		encoder := json.NewEncoder(s.Out)
+		for i, row := range rows {
+			values, _, err := row.Save()
+			if err != nil {
+				return i, err
+			}
+			if err := encoder.Encode(values); err != nil {
+				return i, err
+			}
+		}
+		return len(rows), nil
+	}
+
+	table := tabwriter.NewWriter(s.Out, 0, 4, 2, ' ', 0)
+
+	var header []string
+	for _, field := range s.fields {
+		header = append(header, field.Name)
+	}
+	fmt.Fprintln(table, strings.Join(header, "\t"))
+
+	for i, row := range rows {
+		values, _, err := row.Save()
+		if err != nil {
+			return i, err
+		}
+
+		record := make([]string, len(s.fields))
+		for j, field := range s.fields {
+			if record[j], err = formatValue(values[field.Name]); err != nil {
+				return i, err
+			}
+		}
+		fmt.Fprintln(table, strings.Join(record, "\t"))
+	}
+
+	return len(rows), table.Flush()
+}
+
+// RecordExecution is a no-op, see DryRunSink
+func (s *DryRunSink) RecordExecution(ctx context.Context, exec Execution) error {
+	return nil
+}
+
+// Close the sink replaced by the dry run, if any
+func (s *DryRunSink) Close() error {
+	if s.source == nil {
+		return nil
+	}
+	return s.source.Close()
+}
+
+// readOnlyCheckpoints loads checkpoints from the wrapped store but never saves them
+type readOnlyCheckpoints struct {
+	CheckpointStore
+}
+
+func (s readOnlyCheckpoints) Save(ctx context.Context, checkpoint Checkpoint) error {
+	return nil
+}
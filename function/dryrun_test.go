@@ -0,0 +1,62 @@
+package function
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestDryRunSinkPrintsDDLAndRows(t *testing.T) {
+	var out bytes.Buffer
+	ctx := context.Background()
+	sink := &DryRunSink{Out: &out, Format: TableFormat, Table: "project.dataset.issues"}
+
+	if err := sink.Prepare(ctx, []FieldSchema{
+		FieldSchema{Name: "issue", Type: "string", Path: "key", Required: true},
+		FieldSchema{Name: "labels", Type: "string", Path: "fields.labels", Repeated: true},
+		FieldSchema{Name: "votes", Type: "integer", Path: "fields.votes.votes"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sink.Write(ctx, []Issue{
+		Issue{"issue": "ABC-1", "labels": []interface{}{"a"}, "votes": float64(3)},
+		Issue{"issue": "ABC-10", "labels": []interface{}{}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := "CREATE TABLE `project.dataset.issues` (\n" +
+		"  `issue` STRING NOT NULL,\n" +
+		"  `labels` ARRAY<STRING>,\n" +
+		"  `votes` INT64\n" +
+		");\n\n" +
+		"issue   labels  votes\n" +
+		"ABC-1   [\"a\"]   3\n" +
+		"ABC-10  []      \n"
+
+	if got := out.String(); got != expect {
+		t.Fatalf("got invalid output:\n%v\nexpected:\n%v", got, expect)
+	}
+}
+
+func TestDryRunSinkPrintsSnapshotPartition(t *testing.T) {
+	var out bytes.Buffer
+	sink := &DryRunSink{Out: &out, Format: NDJSONFormat, Table: "project.dataset.issues", Mode: SnapshotMode}
+
+	if err := sink.Prepare(context.Background(), []FieldSchema{
+		FieldSchema{Name: "issue", Type: "string", Path: "key", Required: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := "CREATE TABLE `project.dataset.issues` (\n" +
+		"  `issue` STRING NOT NULL,\n" +
+		"  `snapshot_date` DATE NOT NULL\n" +
+		")\n" +
+		"PARTITION BY `snapshot_date`;\n\n"
+
+	if got := out.String(); got != expect {
+		t.Fatalf("got invalid output:\n%v\nexpected:\n%v", got, expect)
+	}
+}
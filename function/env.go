@@ -3,6 +3,9 @@ package function
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Environment variables for running the function
@@ -10,6 +13,14 @@ type Environment struct {
 	JiraAuthResource string
 	JiraAuthSecret   string
 	JiraProject      string
+	// JiraEpicLinkField is the id of the Epic Link custom field, e.g. customfield_10008
+	JiraEpicLinkField string
+	// JiraSprintField is the id of the Sprint custom field, e.g. customfield_10010, whose legacy sprint strings get parsed
+	JiraSprintField string
+
+	// PrivacyKeyResource and PrivacyKeySecret contain the key for hashing and tokenizing fields, encrypted like the Jira auth
+	PrivacyKeyResource string
+	PrivacyKeySecret   string
 
 	SchemaBucket string
 	SchemaPath   string
@@ -17,30 +28,160 @@ type Environment struct {
 	BigQueryProject string
 	BigQueryDataset string
 	BigQueryTable   string
+	BigQueryMode    string
+	BigQueryKey     string
+	BigQueryHistory bool
+
+	BigQueryInsertMode string
+
+	Sink       string
+	SinkPath   string
+	SinkDriver string
+	SinkTable  string
+
+	Checkpoint string
+	// Archive is the location the raw JSON of fetched issues is stored at, either `gs://bucket/prefix` or `file://path`
+	Archive string
+
+	// Links enables writing the links between issues into the `<table>_links` table
+	Links bool
+	// Users enables writing the users referenced by issues into the `<table>_users` table
+	Users bool
+	// UserPolicy defines how users are pseudonymized, either KeepUsers (default), HashUsers or DropUsers
+	UserPolicy string
+	// UserSaltResource and UserSalt contain the per-deployment secret used to hash users, encrypted like the Jira auth
+	UserSaltResource string
+	UserSalt         string
+
+	// Topic triggering the function, runs reaching the RunTimeout publish their continuation to it if set
+	Topic string
+	// RunTimeout of the function, after which it gets terminated
+	RunTimeout time.Duration
+
+	// Pushgateway is the url of the Prometheus Pushgateway the metrics are pushed to after each run, if set
+	Pushgateway string
+
+	// NotifyWebhook is the url notifications about runs are posted to, if set
+	NotifyWebhook string
+	// NotifyFormat of the notifications, either WebhookFormat (default), SlackFormat, GoogleChatFormat or TeamsFormat
+	NotifyFormat string
+	// NotifyOn is a comma separated list of the runs to notify about, NotifyFailure and NotifySuccess, failures by default
+	NotifyOn string
+	// NotifyEmptyRuns is the amount of consecutive issues runs without inserted rows after which a notification is sent, if set
+	NotifyEmptyRuns int
+
+	// Version of the deployed function, recorded with each execution
+	Version string
+
+	// parseErrors of the variables ParseEnvironment failed to parse, which are reported by Validate
+	parseErrors []error
 }
 
 // ParseEnvironment variables into an Environment
+// Variables failing to be parsed are reported by Validate
 func ParseEnvironment() Environment {
+	var parser envParser
+	history := parser.bool("BIGQUERY_HISTORY")
+	links := parser.bool("SYNC_LINKS")
+	users := parser.bool("SYNC_USERS")
+	timeout := parser.duration("RUN_TIMEOUT")
+	emptyRuns := parser.int("NOTIFY_EMPTY_RUNS")
+
 	return Environment{
-		JiraAuthResource: os.Getenv("JIRA_AUTH_RESOURCE"),
-		JiraAuthSecret:   os.Getenv("JIRA_AUTH_SECRET"),
-		JiraProject:      os.Getenv("JIRA_PROJECT"),
+		JiraAuthResource:  os.Getenv("JIRA_AUTH_RESOURCE"),
+		JiraAuthSecret:    os.Getenv("JIRA_AUTH_SECRET"),
+		JiraProject:       os.Getenv("JIRA_PROJECT"),
+		JiraEpicLinkField: os.Getenv("JIRA_EPIC_LINK_FIELD"),
+		JiraSprintField:   os.Getenv("JIRA_SPRINT_FIELD"),
 		// JiraQuery:    os.Getenv("JIRA_QUERY"),
 
+		PrivacyKeyResource: os.Getenv("PRIVACY_KEY_RESOURCE"),
+		PrivacyKeySecret:   os.Getenv("PRIVACY_KEY_SECRET"),
+
 		SchemaBucket: os.Getenv("SCHEMA_BUCKET"),
 		SchemaPath:   os.Getenv("SCHEMA_PATH"),
 
 		BigQueryProject: os.Getenv("BIGQUERY_PROJECT"),
 		BigQueryDataset: os.Getenv("BIGQUERY_DATASET"),
 		BigQueryTable:   os.Getenv("BIGQUERY_TABLE"),
+		BigQueryMode:    os.Getenv("BIGQUERY_MODE"),
+		BigQueryKey:     os.Getenv("BIGQUERY_KEY"),
+		BigQueryHistory: history,
+
+		BigQueryInsertMode: os.Getenv("BIGQUERY_INSERT_MODE"),
+
+		Sink:       os.Getenv("SINK"),
+		SinkPath:   os.Getenv("SINK_PATH"),
+		SinkDriver: os.Getenv("SINK_DRIVER"),
+		SinkTable:  os.Getenv("SINK_TABLE"),
+
+		Checkpoint: os.Getenv("CHECKPOINT"),
+		Archive:    os.Getenv("ARCHIVE"),
+
+		Links:            links,
+		Users:            users,
+		UserPolicy:       os.Getenv("USER_POLICY"),
+		UserSaltResource: os.Getenv("USER_SALT_RESOURCE"),
+		UserSalt:         os.Getenv("USER_SALT"),
+
+		Topic:      os.Getenv("PUBSUB_TOPIC"),
+		RunTimeout: timeout,
+
+		Pushgateway: os.Getenv("METRICS_PUSHGATEWAY"),
+
+		NotifyWebhook:   os.Getenv("NOTIFY_WEBHOOK"),
+		NotifyFormat:    os.Getenv("NOTIFY_FORMAT"),
+		NotifyOn:        os.Getenv("NOTIFY_ON"),
+		NotifyEmptyRuns: emptyRuns,
+
+		Version: os.Getenv("X_GOOGLE_FUNCTION_VERSION"),
+
+		parseErrors: parser,
+	}
+}
+
+// envParser parses typed environment variables, unset variables result in the zero value
+// Variables failing to be parsed result in the zero value as well and get collected as error
+type envParser []error
+
+func (p *envParser) bool(name string) bool {
+	value, err := strconv.ParseBool(p.lookup(name, "false"))
+	p.collect(name, err)
+	return value
+}
+
+func (p *envParser) duration(name string) time.Duration {
+	value, err := time.ParseDuration(p.lookup(name, "0"))
+	p.collect(name, err)
+	return value
+}
+
+func (p *envParser) int(name string) int {
+	value, err := strconv.Atoi(p.lookup(name, "0"))
+	p.collect(name, err)
+	return value
+}
+
+// lookup the variable name, fallback if it is unset or empty
+func (p *envParser) lookup(name, fallback string) string {
+	if value := os.Getenv(name); len(value) > 0 {
+		return value
+	}
+	return fallback
+}
+
+func (p *envParser) collect(name string, err error) {
+	if err != nil {
+		*p = append(*p, fmt.Errorf("invalid environment variable: %s: %v", name, err))
 	}
 }
 
 // Validate the environment
 func (e Environment) Validate() error {
-	if len(e.JiraAuthResource) < 1 {
-		return fmt.Errorf("missing environment variable: %s", "JIRA_AUTH_RESOURCE")
+	if len(e.parseErrors) > 0 {
+		return e.parseErrors[0]
 	}
+
 	if len(e.JiraAuthSecret) < 1 {
 		return fmt.Errorf("missing environment variable: %s", "JIRA_AUTH_SECRET")
 	}
@@ -50,9 +191,95 @@ func (e Environment) Validate() error {
 	if len(e.SchemaPath) < 1 {
 		return fmt.Errorf("missing environment variable: %s", "SCHEMA_PATH")
 	}
-	if len(e.SchemaBucket) < 1 {
-		return fmt.Errorf("missing environment variable: %s", "SCHEMA_BUCKET")
+
+	switch e.UserPolicy {
+	case "", KeepUsers:
+	case HashUsers, DropUsers:
+		if len(e.UserSalt) < 1 {
+			return fmt.Errorf("missing environment variable: %s", "USER_SALT")
+		}
+		// the archive keeps the raw issues for reprocessing, which would contain the users the policy removes
+		if len(e.Archive) > 0 {
+			return fmt.Errorf("invalid environment variable: %s: can not be combined with policy %q", "ARCHIVE", e.UserPolicy)
+		}
+	default:
+		return fmt.Errorf("invalid environment variable: %s: unknown policy %q", "USER_POLICY", e.UserPolicy)
+	}
+
+	if err := e.validateNotify(); err != nil {
+		return err
+	}
+
+	switch e.Sink {
+	case "", BigQuerySink:
+		return e.validateBigQuery()
+	case NDJSONSink, CSVSink, SQLSink:
+		if len(e.SinkPath) < 1 {
+			return fmt.Errorf("missing environment variable: %s", "SINK_PATH")
+		}
+		if e.BigQueryMode == MergeMode && len(e.BigQueryKey) < 1 {
+			return fmt.Errorf("missing environment variable: %s", "BIGQUERY_KEY")
+		}
+	case ParquetSink:
+		if len(e.SchemaBucket) < 1 {
+			return fmt.Errorf("missing environment variable: %s", "SCHEMA_BUCKET")
+		}
+		// written files are never rewritten, so tables replacing their rows on each run are not supported
+		if e.BigQueryMode == MergeMode {
+			return fmt.Errorf("invalid environment variable: %s: %s mode is not supported by the %s sink", "BIGQUERY_MODE", MergeMode, ParquetSink)
+		}
+		if e.Links {
+			return fmt.Errorf("invalid environment variable: %s: not supported by the %s sink", "SYNC_LINKS", ParquetSink)
+		}
+		if e.Users {
+			return fmt.Errorf("invalid environment variable: %s: not supported by the %s sink", "SYNC_USERS", ParquetSink)
+		}
+	default:
+		return fmt.Errorf("invalid environment variable: %s: unknown sink %q", "SINK", e.Sink)
+	}
+
+	return nil
+}
+
+// validateNotify checks the variables configuring notifications
+func (e Environment) validateNotify() error {
+	switch e.NotifyFormat {
+	case "", WebhookFormat, SlackFormat, GoogleChatFormat, TeamsFormat:
+	default:
+		return fmt.Errorf("invalid environment variable: %s: unknown format %q", "NOTIFY_FORMAT", e.NotifyFormat)
+	}
+
+	for _, event := range strings.Split(e.NotifyOn, ",") {
+		switch strings.TrimSpace(event) {
+		case "", NotifyFailure, NotifySuccess:
+		default:
+			return fmt.Errorf("invalid environment variable: %s: unknown event %q", "NOTIFY_ON", event)
+		}
 	}
+
+	if e.NotifyEmptyRuns < 0 {
+		return fmt.Errorf("invalid environment variable: %s: negative value %d", "NOTIFY_EMPTY_RUNS", e.NotifyEmptyRuns)
+	}
+
+	return nil
+}
+
+// notifies reports whether runs resulting in the event are notified about, failures are by default
+func (e Environment) notifies(event string) bool {
+	if len(strings.TrimSpace(e.NotifyOn)) < 1 {
+		return event == NotifyFailure
+	}
+
+	for _, on := range strings.Split(e.NotifyOn, ",") {
+		if strings.TrimSpace(on) == event {
+			return true
+		}
+	}
+	return false
+}
+
+// validateBigQuery checks the variables required by the bigquery sink
+func (e Environment) validateBigQuery() error {
 	if len(e.BigQueryProject) < 1 {
 		return fmt.Errorf("missing environment variable: %s", "BIGQUERY_PROJECT")
 	}
@@ -63,5 +290,21 @@ func (e Environment) Validate() error {
 		return fmt.Errorf("missing environment variable: %s", "BIGQUERY_TABLE")
 	}
 
+	switch e.BigQueryMode {
+	case "", AppendMode, SnapshotMode:
+	case MergeMode:
+		if len(e.BigQueryKey) < 1 {
+			return fmt.Errorf("missing environment variable: %s", "BIGQUERY_KEY")
+		}
+	default:
+		return fmt.Errorf("invalid environment variable: %s: unknown mode %q", "BIGQUERY_MODE", e.BigQueryMode)
+	}
+
+	switch e.BigQueryInsertMode {
+	case "", StreamInsert, LoadInsert:
+	default:
+		return fmt.Errorf("invalid environment variable: %s: unknown mode %q", "BIGQUERY_INSERT_MODE", e.BigQueryInsertMode)
+	}
+
 	return nil
 }
@@ -0,0 +1,56 @@
+package function
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseEnvironmentReportsInvalidVariables(t *testing.T) {
+	base := map[string]string{
+		"JIRA_AUTH_SECRET": "{}",
+		"JIRA_PROJECT":     "ABC",
+		"SCHEMA_PATH":      "schema.json",
+		"SINK":             NDJSONSink,
+		"SINK_PATH":        "out",
+	}
+	for name, value := range base {
+		os.Setenv(name, value)
+		defer os.Unsetenv(name)
+	}
+
+	for _, c := range []struct {
+		name  string
+		value string
+		valid bool
+	}{
+		{"RUN_TIMEOUT", "540s", true},
+		{"RUN_TIMEOUT", "540", false},
+		{"BIGQUERY_HISTORY", "true", true},
+		{"BIGQUERY_HISTORY", "yes", false},
+		{"SYNC_LINKS", "on", false},
+		{"SYNC_USERS", "1", true},
+		{"SYNC_USERS", "enabled", false},
+		{"NOTIFY_EMPTY_RUNS", "3", true},
+		{"NOTIFY_EMPTY_RUNS", "three", false},
+		{"NOTIFY_EMPTY_RUNS", "", true},
+	} {
+		os.Setenv(c.name, c.value)
+		err := ParseEnvironment().Validate()
+		os.Unsetenv(c.name)
+
+		if c.valid && err != nil {
+			t.Fatalf("got invalid error for %s=%q: %v\nexpected: %v", c.name, c.value, err, nil)
+		}
+		if !c.valid && (err == nil || !strings.Contains(err.Error(), c.name)) {
+			t.Fatalf("got invalid error for %s=%q: %v\nexpected: %v", c.name, c.value, err, "invalid "+c.name)
+		}
+	}
+
+	os.Setenv("RUN_TIMEOUT", "540s")
+	defer os.Unsetenv("RUN_TIMEOUT")
+	if got := ParseEnvironment().RunTimeout; got != 540*time.Second {
+		t.Fatalf("got invalid run timeout: %v\nexpected: %v", got, 540*time.Second)
+	}
+}
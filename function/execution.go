@@ -0,0 +1,100 @@
+package function
+
+import (
+	"time"
+
+	"cloud.google.com/go/bigquery"
+)
+
+const (
+	// ExecutionSucceeded is the status of a run that inserted all issues
+	ExecutionSucceeded = "success"
+	// ExecutionFailed is the status of a run that was aborted by an error
+	ExecutionFailed = "failed"
+)
+
+// Execution of the inserter
+type Execution struct {
+	Timestamp  time.Time `bigquery:"timestamp" json:"timestamp,omitempty"`
+	Finished   time.Time `bigquery:"finished" json:"finished,omitempty"`
+	Duration   float64   `bigquery:"duration" json:"duration,omitempty"`
+	Status     string    `bigquery:"status" json:"status,omitempty"`
+	Error      string    `bigquery:"error" json:"error,omitempty"`
+	Fetched    int       `bigquery:"fetched" json:"fetched,omitempty"`
+	Inserted   int       `bigquery:"inserted" json:"inserted,omitempty"`
+	Rejected   int       `bigquery:"rejected" json:"rejected,omitempty"`
+	JQL        string    `bigquery:"jql" json:"jql,omitempty"`
+	SchemaHash string    `bigquery:"schema_hash" json:"schemaHash,omitempty"`
+	Version    string    `bigquery:"version" json:"version,omitempty"`
+	Sync       string    `bigquery:"sync" json:"sync,omitempty"`
+	Deleted    int       `bigquery:"deleted" json:"deleted,omitempty"`
+	// Checkpoint is the point in time up to which the run synced issues, if it differs from the Timestamp
+	Checkpoint bigquery.NullTimestamp `bigquery:"checkpoint" json:"checkpoint"`
+	// Position up to which a run stopped early read a source not ordered by time, see Checkpoint.Position
+	Position string `bigquery:"position" json:"position,omitempty"`
+}
+
+// executionSchema of the executions table
+// Only the fields of the initial version are required, so existing tables can be extended
+var executionSchema = bigquery.Schema{
+	&bigquery.FieldSchema{Name: "timestamp", Required: true, Type: bigquery.TimestampFieldType},
+	&bigquery.FieldSchema{Name: "finished", Type: bigquery.TimestampFieldType},
+	&bigquery.FieldSchema{Name: "duration", Type: bigquery.FloatFieldType, Description: "duration of the run in seconds"},
+	&bigquery.FieldSchema{Name: "status", Type: bigquery.StringFieldType},
+	&bigquery.FieldSchema{Name: "error", Type: bigquery.StringFieldType},
+	&bigquery.FieldSchema{Name: "fetched", Type: bigquery.IntegerFieldType},
+	&bigquery.FieldSchema{Name: "inserted", Required: true, Type: bigquery.IntegerFieldType},
+	&bigquery.FieldSchema{Name: "rejected", Type: bigquery.IntegerFieldType},
+	&bigquery.FieldSchema{Name: "jql", Type: bigquery.StringFieldType},
+	&bigquery.FieldSchema{Name: "schema_hash", Type: bigquery.StringFieldType},
+	&bigquery.FieldSchema{Name: "version", Type: bigquery.StringFieldType},
+	&bigquery.FieldSchema{Name: "sync", Type: bigquery.StringFieldType},
+	&bigquery.FieldSchema{Name: "deleted", Type: bigquery.IntegerFieldType, Description: "issues removed by a reconcile run"},
+	&bigquery.FieldSchema{Name: "checkpoint", Type: bigquery.TimestampFieldType, Description: "end of the range synced by a backfill window"},
+	&bigquery.FieldSchema{Name: "position", Type: bigquery.StringFieldType, Description: "last archived version written by a reprocess run stopped early"},
+}
+
+// Finish the execution by setting it's end time, duration and status based on err
+func (e *Execution) Finish(err error) {
+	e.Finished = time.Now().UTC()
+	e.Duration = e.Finished.Sub(e.Timestamp).Seconds()
+	e.Status = ExecutionSucceeded
+	if err != nil {
+		e.Status = ExecutionFailed
+		e.Error = err.Error()
+	}
+}
+
+// rejectedRows of a write of rows, which inserted some of them before failing with err
+// Only the rows of a PutMultiError got rejected, other errors count all rows which were not inserted
+func rejectedRows(rows, inserted int, err error) int {
+	putErr, ok := err.(bigquery.PutMultiError)
+	if !ok {
+		return rows - inserted
+	}
+
+	failed := make(map[int]bool, len(putErr))
+	for _, rowErr := range putErr {
+		failed[rowErr.RowIndex] = true
+	}
+	return len(failed)
+}
+
+// checkpoint of the execution, which is it's Checkpoint if set and it's Timestamp otherwise
+func (e Execution) checkpoint() time.Time {
+	if e.Checkpoint.Valid {
+		return e.Checkpoint.Timestamp
+	}
+	return e.Timestamp
+}
+
+// succeeded reports whether the execution is a successful run of sync
+func (e Execution) succeeded(sync string) bool {
+	return e.Status == ExecutionSucceeded && e.of(sync)
+}
+
+// of reports whether the execution is a run of sync
+// Executions recorded before syncs were introduced belong to IssuesSync
+func (e Execution) of(sync string) bool {
+	return e.Sync == sync || (len(e.Sync) < 1 && sync == IssuesSync)
+}
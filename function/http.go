@@ -0,0 +1,64 @@
+package function
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/seibert-media/golibs/log"
+	"go.uber.org/zap"
+)
+
+// maxRunOptions is the maximum size of the run options in a request body
+const maxRunOptions = 1 << 20
+
+// RunHandler runs the sync selected by the JSON encoded RunOptions in the body of POST requests
+// It responds with the Summary of the run, with status 500 if it failed and 400 if the options are invalid
+func RunHandler(env Environment) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSON(w, http.StatusMethodNotAllowed, Summary{Status: ExecutionFailed, Error: "method not allowed, use POST"})
+			return
+		}
+
+		data, err := ioutil.ReadAll(io.LimitReader(r.Body, maxRunOptions))
+		if err != nil {
+			log.From(ctx).Error("reading run options", zap.Error(err))
+			writeJSON(w, http.StatusBadRequest, Summary{Status: ExecutionFailed, Error: err.Error()})
+			return
+		}
+
+		opts, err := ParseRunOptions(data)
+		if err != nil {
+			log.From(ctx).Error("parsing run options", zap.Error(err))
+			writeJSON(w, http.StatusBadRequest, Summary{Sync: opts.Sync, Status: ExecutionFailed, Error: err.Error()})
+			return
+		}
+
+		log.From(ctx).Debug("validating environment")
+		if err := env.Validate(); err != nil {
+			log.From(ctx).Error("validating environment", zap.Error(err))
+			writeJSON(w, http.StatusInternalServerError, Summary{Sync: opts.Sync, Status: ExecutionFailed, Error: err.Error()})
+			return
+		}
+
+		summary, err := RunSummary(ctx, env, opts)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, summary)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, summary)
+	})
+}
+
+// writeJSON encoded value as response with the status
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,85 @@
+package function
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunHandler(t *testing.T) {
+	jira := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/api/2/search" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"startAt":0,"maxResults":500,"total":2,"issues":[{"id":"1","key":"ABC-1","fields":{}},{"id":"2","key":"ABC-2","fields":{}}]}`))
+	}))
+	defer jira.Close()
+
+	dir, err := ioutil.TempDir("", "http")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	auth, err := json.Marshal(JiraAuth{URL: jira.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := Environment{
+		JiraAuthSecret: string(auth),
+		JiraProject:    "ABC",
+		Sink:           NDJSONSink,
+		SinkPath:       dir,
+		SchemaPath:     filepath.Join(dir, "schema.json"),
+	}
+	if err := ioutil.WriteFile(env.SchemaPath, []byte(`[{"name":"issue","type":"STRING","path":"key"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(RunHandler(env))
+	defer server.Close()
+
+	for _, c := range []struct {
+		method, body string
+		status       int
+		expect       Summary
+	}{
+		{"POST", `{"jql":"project = ABC"}`, http.StatusOK, Summary{Sync: IssuesSync, Status: ExecutionSucceeded, Fetched: 2, Inserted: 2}},
+		{"POST", `{"sync":"unknown"}`, http.StatusBadRequest, Summary{Sync: "unknown", Status: ExecutionFailed}},
+		{"POST", `{"sync":"reprocess"}`, http.StatusInternalServerError, Summary{Sync: ReprocessSync, Status: ExecutionFailed}},
+		{"GET", "", http.StatusMethodNotAllowed, Summary{Status: ExecutionFailed}},
+	} {
+		req, err := http.NewRequest(c.method, server.URL, strings.NewReader(c.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got Summary
+		err = json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != c.status {
+			t.Fatalf("got invalid status for %s %s: %v\nexpected: %v", c.method, c.body, resp.StatusCode, c.status)
+		}
+		if got.Sync != c.expect.Sync || got.Status != c.expect.Status || got.Fetched != c.expect.Fetched || got.Inserted != c.expect.Inserted {
+			t.Fatalf("got invalid summary for %s %s: %+v\nexpected: %+v", c.method, c.body, got, c.expect)
+		}
+		if c.status != http.StatusOK && len(got.Error) < 1 {
+			t.Fatalf("got invalid summary for %s %s: %+v\nexpected an error", c.method, c.body, got)
+		}
+	}
+}
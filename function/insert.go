@@ -2,46 +2,63 @@ package function
 
 import (
 	"context"
-	"flag"
+	"fmt"
 	"time"
 
+	"cloud.google.com/go/bigquery"
 	"github.com/seibert-media/golibs/log"
 	"go.uber.org/zap"
 )
 
-var ignoreLastRun = flag.Bool("ignoreLastRun", false, "ignores the last execution time and processes all issues again")
+// InsertIssues into the sink selected by the environment, bigquery by default
+// Every run gets recorded in the sink's executions, including the error of failed runs
+// In a dry run, the rows are printed to stdout instead and nothing gets created, written or recorded
+func InsertIssues(ctx context.Context, env Environment, opts RunOptions) (err error) {
+	if err := opts.validateMode(env.BigQueryMode); err != nil {
+		log.From(ctx).Error("validating run options", zap.Error(err))
+		return err
+	}
+
+	exec := Execution{Timestamp: time.Now().UTC(), Version: env.Version, Sync: IssuesSync}
+
+	sink, checkpoints, err := openSink(ctx, env, opts, IssuesSync)
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+	defer checkpoints.Close()
+	defer recordExecution(ctx, sink, &exec, &err)
 
-// InsertIssues into bigquery
-func InsertIssues(ctx context.Context, env Environment) error {
 	fields, err := GetSchema(ctx, env.SchemaBucket, env.SchemaPath)
 	if err != nil {
 		log.From(ctx).Error("reading schema", zap.String("bucket", env.SchemaBucket), zap.String("path", env.SchemaPath), zap.Error(err))
 		return err
 	}
+	exec.SchemaHash = SchemaHash(fields)
 
-	log.From(ctx).Debug("creating bigquery client")
-	bigquery, err := NewBigQueryClient(ctx, env)
+	privacy, err := NewPrivacyFilter(ctx, env, fields)
 	if err != nil {
-		log.From(ctx).Error("creating bigquery client", zap.Error(err))
+		log.From(ctx).Error("loading privacy", zap.Error(err))
 		return err
 	}
 
-	if err := bigquery.Prepare(ctx, fields); err != nil {
+	if err := sink.Prepare(ctx, fields); err != nil {
+		log.From(ctx).Error("preparing sink", zap.Error(err))
 		return err
 	}
 
-	var exec Execution
+	var last Checkpoint
 
-	if !*ignoreLastRun {
-		log.From(ctx).Debug("fetching last execution")
-		exec, err = bigquery.LastExecution(ctx)
+	// snapshots always contain all issues, so there is no need for a checkpoint
+	if env.BigQueryMode != SnapshotMode && !opts.FullResync {
+		log.From(ctx).Debug("loading checkpoint")
+		last, err = checkpoints.Load(ctx)
 		if err != nil {
-			log.From(ctx).Error("fetching last execution", zap.Error(err))
+			log.From(ctx).Error("loading checkpoint", zap.Error(err))
+			return err
 		}
 	}
 
-	var now = time.Now().UTC()
-
 	log.From(ctx).Debug("creating jira client")
 	jira, err := NewJiraClient(ctx, env)
 	if err != nil {
@@ -49,12 +66,178 @@ func InsertIssues(ctx context.Context, env Environment) error {
 		return err
 	}
 
-	log.From(ctx).Info("fetching issues")
-	issues, err := jira.Issues(ctx, exec.Timestamp)
+	exec.JQL, err = issuesQuery(jira, last, opts, exec.Timestamp)
 	if err != nil {
+		log.From(ctx).Error("building query", zap.Error(err))
+		return err
+	}
+
+	// ad-hoc runs only fetch some issues, so they keep the previous checkpoint
+	if opts.adhoc() {
+		log.From(ctx).Info("ad-hoc run, keeping the checkpoint", zap.Time("checkpoint", last.Timestamp))
+		exec.Checkpoint = bigquery.NullTimestamp{Timestamp: last.Timestamp, Valid: true}
+	}
+
+	// snapshots have to contain all issues, so they can not be continued or stopped early
+	search := ctx
+	if env.BigQueryMode != SnapshotMode {
+		jira.Deadline = runDeadline(ctx, env, opts, exec.Timestamp)
+	} else {
+		search = withStop(ctx, nil)
+	}
+
+	log.From(ctx).Info("fetching issues", zap.String("jql", exec.JQL))
+	issues, err := jira.Issues(search, exec.JQL, 0)
+	truncated := err == ErrDeadline
+	if err != nil && !truncated {
 		log.From(ctx).Error("fetching issues", zap.Error(err))
 		return err
 	}
+	exec.Fetched = len(issues)
+
+	if err := archiveIssues(ctx, env, opts, issues); err != nil {
+		return err
+	}
+
+	if err := writeIssues(ctx, env, opts, sink, fields, privacy, issues, &exec); err != nil {
+		return err
+	}
+
+	// a truncated run only covers the issues up to the last fetched one, the continuation starts there
+	var next time.Time
+	if truncated {
+		if next, err = continuedCursor(last, opts, issues); err != nil {
+			log.From(ctx).Error("reading cursor", zap.Error(err))
+			return err
+		}
+	}
+
+	if !opts.adhoc() {
+		checkpoint := Checkpoint{Timestamp: exec.Timestamp}
+		if truncated {
+			checkpoint.Timestamp = next
+			exec.Checkpoint = bigquery.NullTimestamp{Timestamp: next, Valid: true}
+		}
+
+		log.From(ctx).Debug("saving checkpoint")
+		if err := checkpoints.Save(ctx, checkpoint); err != nil {
+			log.From(ctx).Error("saving checkpoint", zap.Error(err))
+			return err
+		}
+	}
+
+	if truncated {
+		if err := Continue(ctx, env, continuation(opts, next, exec.Timestamp)); err != nil {
+			return err
+		}
+	}
+
+	log.From(ctx).Info("inserted", zap.Int("issues", exec.Inserted))
+	return nil
+}
+
+// issuesQuery of a run, which is the JQL or range of opts if set and all issues updated since the last checkpoint otherwise
+// Ad-hoc runs are ordered by update time and key and start at their cursor, so they can be continued like regular runs
+func issuesQuery(jira JiraClient, last Checkpoint, opts RunOptions, now time.Time) (string, error) {
+	if !opts.adhoc() {
+		return jira.Query(last.Timestamp)
+	}
+
+	jql := opts.JQL
+	if len(jql) < 1 {
+		since, until, err := opts.Range(now)
+		if err != nil {
+			return "", err
+		}
+		if jql, err = jira.RangeQuery(since, until); err != nil {
+			return "", err
+		}
+	}
+
+	cursor, err := opts.cursor()
+	if err != nil {
+		return "", err
+	}
+
+	return jira.CursorQuery(jql, cursor)
+}
+
+// continuedCursor of a truncated run with opts, which is the update time of the last fetched issue
+// The cursor has to be later than where the run started, which is the last checkpoint of regular runs and the cursor or since of ad-hoc runs,
+// otherwise the continuation would fetch the same issues again and never finish
+func continuedCursor(last Checkpoint, opts RunOptions, issues []Issue) (time.Time, error) {
+	next, err := cursor(issues)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	from := last.Timestamp
+	if opts.adhoc() {
+		if from, err = opts.cursor(); err != nil {
+			return time.Time{}, err
+		}
+		if len(opts.Cursor) < 1 {
+			if from, err = parseBound(opts.Since); err != nil {
+				return time.Time{}, err
+			}
+		}
+	}
+
+	if !advances(next, from) {
+		return time.Time{}, fmt.Errorf("reached deadline without progress: all fetched issues were updated at %s", next.Format(time.RFC3339))
+	}
+
+	return next, nil
+}
+
+// continuation of a truncated run with opts, which fetched issues up to the cursor before reaching it's deadline started at now
+// Regular runs continue from their saved checkpoint, ad-hoc runs from the cursor carried in their options
+// The range of an ad-hoc run is fixed to end at now, so the continuation does not fetch the issues updated in the meantime
+func continuation(opts RunOptions, cursor time.Time, now time.Time) RunOptions {
+	if !opts.adhoc() {
+		return RunOptions{}
+	}
+
+	opts.Cursor = cursor.UTC().Format(time.RFC3339)
+	if len(opts.JQL) < 1 && len(opts.Until) < 1 {
+		opts.Until = now.UTC().Format(time.RFC3339)
+	}
+
+	return opts
+}
+
+// archiveIssues as returned by Jira, if an archive is configured and it is not a dry run
+func archiveIssues(ctx context.Context, env Environment, opts RunOptions, issues []Issue) error {
+	if len(env.Archive) < 1 || opts.DryRun {
+		return nil
+	}
+
+	log.From(ctx).Debug("archiving issues", zap.String("archive", env.Archive))
+	archive, err := NewArchive(ctx, env)
+	if err != nil {
+		log.From(ctx).Error("creating archive", zap.Error(err))
+		return err
+	}
+	defer archive.Close()
+
+	if err := archive.Store(ctx, issues); err != nil {
+		log.From(ctx).Error("archiving issues", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// writeIssues extracts the rows of the raw issues and writes them into the sink, followed by their links and users if enabled
+// The issues get modified in place by the environment's user policy, the written rows are added to the counts of exec
+func writeIssues(ctx context.Context, env Environment, opts RunOptions, sink Sink, fields []FieldSchema, privacy PrivacyFilter, issues []Issue, exec *Execution) error {
+	// users have to be collected before they get pseudonymized, as the policy removes their self link
+	var users []Issue
+	if env.Users {
+		users = CollectUsers(issues)
+	}
+	env.userPolicy().Apply(issues)
+	parseSprintField(issues, env.JiraSprintField)
 
 	converter := FieldExtractor(fields)
 
@@ -64,17 +247,36 @@ func InsertIssues(ctx context.Context, env Environment) error {
 		log.From(ctx).Error("converting issues", zap.Error(err))
 		return err
 	}
+	privacy.Apply(converted)
 
 	log.From(ctx).Info("inserting")
-	if err := bigquery.Insert(ctx, converted); err != nil {
+	inserted, err := sink.Write(ctx, converted)
+	exec.Inserted += inserted
+	exec.Rejected += rejectedRows(len(converted), inserted, err)
+	if err != nil {
 		log.From(ctx).Error("inserting", zap.Error(err))
 		return err
 	}
 
-	if err := bigquery.RecordExecution(ctx, now, len(issues)); err != nil {
-		return err
+	if env.Links {
+		log.From(ctx).Info("inserting links")
+		links, err := writeLinks(ctx, env, opts, issues, exec.Timestamp)
+		if err != nil {
+			log.From(ctx).Error("inserting links", zap.Error(err))
+			return err
+		}
+		log.From(ctx).Info("inserted links", zap.Int("links", links))
+	}
+
+	if env.Users {
+		log.From(ctx).Info("inserting users")
+		inserted, err := writeUsers(ctx, env, opts, users)
+		if err != nil {
+			log.From(ctx).Error("inserting users", zap.Error(err))
+			return err
+		}
+		log.From(ctx).Info("inserted users", zap.Int("users", inserted))
 	}
 
-	log.From(ctx).Info("inserted", zap.Int("issues", len(converted)))
 	return nil
 }
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,29 +19,60 @@ import (
 // Issue to be stored
 type Issue map[string]interface{}
 
+// jiraTimestamp is the layout of timestamps returned by Jira
+const jiraTimestamp = "2006-01-02T15:04:05.999-0700"
+
+// insertIDKey is the reserved key an extracted issue carries it's insert id in
+const insertIDKey = "_insertId"
+
 // Save implements bigquery.ValueSaver
 // It takes care of transforming a Jira Timestamp into a BigQuery Timestamp
+// and returns the insert id recorded during extraction, which is not part of the values
 func (i Issue) Save() (map[string]bigquery.Value, string, error) {
 	values := make(map[string]bigquery.Value)
 	for key, value := range i {
-		if time, err := time.Parse("2006-01-02T15:04:05.999-0700", fmt.Sprint(value)); err == nil {
+		if key == insertIDKey {
+			continue
+		}
+		if time, err := time.Parse(jiraTimestamp, fmt.Sprint(value)); err == nil {
 			value = time.UTC().Format("2006-01-02 15:04:05.999999")
 		}
 		values[key] = value
 	}
 
-	return values, "", nil
+	insertID, _ := i[insertIDKey].(string)
+
+	return values, insertID, nil
+}
+
+// InsertID derives a deterministic id from the issue's id and update time,
+// which allows BigQuery to deduplicate retried inserts of the same issue version
+// An empty string is returned if either of them is missing
+func (i Issue) InsertID() string {
+	id, hasID := i["id"]
+	fields, _ := i["fields"].(map[string]interface{})
+	updated, hasUpdated := fields["updated"]
+	if !hasID || !hasUpdated {
+		return ""
+	}
+
+	return fmt.Sprintf("%v-%v", id, updated)
 }
 
 // JiraClient wraps a jira.Client to provided helpers
 type JiraClient struct {
 	*jira.Client
 	Project string
+	// Expand the issues returned by Issues, e.g. with their `changelog`
+	Expand string
+	// Deadline after which searches stop requesting further pages and return ErrDeadline, if set
+	// Searches stop the same way once the run gets stopped, see withStop
+	Deadline time.Time
 }
 
 // NewJiraClient from the passed in environment
 func NewJiraClient(ctx context.Context, env Environment) (JiraClient, error) {
-	auth, err := DecodeJiraAuth(ctx, env.JiraAuthResource, env.JiraAuthSecret)
+	auth, err := LoadJiraAuth(ctx, env)
 	if err != nil {
 		return JiraClient{}, err
 	}
@@ -54,17 +87,23 @@ func NewJiraClient(ctx context.Context, env Environment) (JiraClient, error) {
 		return JiraClient{}, err
 	}
 
-	return JiraClient{Client: jira, Project: env.JiraProject}, nil
+	client := JiraClient{Client: jira, Project: env.JiraProject}
+	// the changelog contains the authors of all changes to an issue
+	if env.Users {
+		client.Expand = "changelog"
+	}
+
+	return client, nil
 }
 
-// Issues from the client's jira instance
-func (c JiraClient) Issues(ctx context.Context, lastRun time.Time) ([]Issue, error) {
+// Query for all issues in the client's project updated since lastRun
+func (c JiraClient) Query(lastRun time.Time) (string, error) {
 
 	filter := ""
 	if !lastRun.IsZero() {
 		lastRun, err := c.inUserTimezone(lastRun)
 		if err != nil {
-			return nil, err
+			return "", err
 		}
 
 		// give 2 minute of buffer so we make sure to not miss any issues
@@ -73,11 +112,66 @@ func (c JiraClient) Issues(ctx context.Context, lastRun time.Time) ([]Issue, err
 		filter = fmt.Sprintf(` AND updated >= "%s"`, lastRun.Format("2006-01-02 15:04"))
 	}
 
-	jql := fmt.Sprintf("project = %s%s ORDER BY updated ASC", c.Project, filter)
+	return fmt.Sprintf("project = %s%s ORDER BY updated ASC", c.Project, filter), nil
+}
 
-	issues, err := c.Search(ctx, jql, &jira.SearchOptions{MaxResults: 500})
+// RangeQuery for all issues in the client's project updated at or after since and before until
+// A zero since leaves the range open towards the past
+func (c JiraClient) RangeQuery(since, until time.Time) (string, error) {
+	filter := ""
+	if !since.IsZero() {
+		since, err := c.inUserTimezone(since)
+		if err != nil {
+			return "", err
+		}
+		filter = fmt.Sprintf(` AND updated >= "%s"`, since.Format("2006-01-02 15:04"))
+	}
 
-	return issues, err
+	until, err := c.inUserTimezone(until)
+	if err != nil {
+		return "", err
+	}
+	filter += fmt.Sprintf(` AND updated < "%s"`, until.Format("2006-01-02 15:04"))
+
+	return fmt.Sprintf("project = %s%s ORDER BY updated ASC", c.Project, filter), nil
+}
+
+// orderClause at the end of a JQL query, unless it is part of a quoted value
+var orderClause = regexp.MustCompile(`(?i)\s*\border\s+by\s+[^"']*$`)
+
+// CursorQuery orders the issues matching jql by their update time and key, replacing the query's own order
+// If the cursor is set, only issues updated at or after it are selected, so a query can be continued where it stopped
+func (c JiraClient) CursorQuery(jql string, cursor time.Time) (string, error) {
+	jql = orderClause.ReplaceAllString(jql, "")
+
+	if !cursor.IsZero() {
+		cursor, err := c.inUserTimezone(cursor)
+		if err != nil {
+			return "", err
+		}
+
+		filter := fmt.Sprintf(`updated >= "%s"`, cursor.Format("2006-01-02 15:04"))
+		if len(strings.TrimSpace(jql)) > 0 {
+			filter = fmt.Sprintf("(%s) AND %s", jql, filter)
+		}
+		jql = filter
+	}
+
+	return fmt.Sprintf("%s ORDER BY updated ASC, key ASC", jql), nil
+}
+
+// Issues matching jql from the client's jira instance, skipping the first startAt issues
+func (c JiraClient) Issues(ctx context.Context, jql string, startAt int) ([]Issue, error) {
+	return c.Search(ctx, jql, &jira.SearchOptions{MaxResults: 500, StartAt: startAt, Expand: c.Expand})
+}
+
+// IssueKeys of all issues matching jql, only requesting the provided fields to keep the responses small
+// The issues always contain their id and key, even if fields is empty
+func (c JiraClient) IssueKeys(ctx context.Context, jql string, fields ...string) ([]Issue, error) {
+	if len(fields) < 1 {
+		fields = []string{"key"}
+	}
+	return c.Search(ctx, jql, &jira.SearchOptions{MaxResults: 1000, Fields: fields})
 }
 
 // Search without decoding to the jira.Issue type, to get all fields without modification
@@ -88,16 +182,26 @@ func (c JiraClient) Search(ctx context.Context, jql string, options *jira.Search
 	issues := []Issue{}
 	total := -1
 
-	for len(issues) < total || total == -1 {
+	// the position is tracked by StartAt, as the first issues may be skipped by the caller
+	for total == -1 || options.StartAt < total {
+		if len(issues) > 0 && deadlineReached(ctx, c.Deadline) {
+			log.From(ctx).Info("reached deadline", zap.Int("current", len(issues)), zap.Int("total", total))
+			jiraDeadlines.Inc()
+			return issues, ErrDeadline
+		}
+
 		log.From(ctx).Debug("reading page", zap.Int("current", len(issues)), zap.Int("total", total), zap.Int("startAt", options.StartAt), zap.Int("maxResults", options.MaxResults))
 
-		resp, err := c.search(urlFromOptions(jql, options))
+		resp, err := c.page(ctx, urlFromOptions(jql, options))
 		if err != nil {
 			return nil, err
 		}
 
 		issues = append(issues, resp.Issues...)
 		total = resp.Total
+		if len(resp.Issues) < 1 {
+			break
+		}
 
 		options.StartAt = resp.StartAt + resp.MaxResults
 		options.MaxResults = resp.MaxResults
@@ -113,23 +217,59 @@ type searchResponse struct {
 	Issues     []Issue `json:"issues"`
 }
 
-func (c JiraClient) search(url string) (searchResponse, error) {
+// maxPageAttempts before giving up on reading a page of search results
+const maxPageAttempts = 3
+
+// page of search results, retrying requests which were throttled, failed on Jira's side or received no response
+func (c JiraClient) page(ctx context.Context, url string) (searchResponse, error) {
+	body, status, err := c.search(ctx, url)
+	for attempt := 1; err != nil && attempt < maxPageAttempts && retryable(ctx, status); attempt++ {
+		log.From(ctx).Warn("retrying page", zap.Int("status", status), zap.Int("attempt", attempt), zap.Error(err))
+		jiraRetries.WithLabelValues(strconv.Itoa(status)).Inc()
+		select {
+		case <-ctx.Done():
+			return searchResponse{}, ctx.Err()
+		case <-time.After(time.Duration(attempt) * time.Second):
+		}
+		body, status, err = c.search(ctx, url)
+	}
+
+	return body, err
+}
+
+// retryable reports whether a request which failed with the status code, 0 if no response was received, may succeed later
+func retryable(ctx context.Context, status int) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	return status == 0 || status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// search a single page, which is observed in the jira metrics
+func (c JiraClient) search(ctx context.Context, url string) (body searchResponse, status int, err error) {
+	start := time.Now()
+	defer func() { observeRequest(start, status) }()
+
 	req, err := c.NewRequest("GET", url, nil)
 	if err != nil {
-		return searchResponse{}, err
+		return searchResponse{}, status, err
 	}
+	req = req.WithContext(ctx)
 
-	var body searchResponse
 	resp, err := c.Do(req, &body)
+	if resp != nil {
+		status = resp.StatusCode
+	}
 	if err != nil {
-		return searchResponse{}, err
+		return searchResponse{}, status, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return searchResponse{}, fmt.Errorf("searching issues: status %v", resp.StatusCode)
+		return searchResponse{}, status, fmt.Errorf("searching issues: status %v", resp.StatusCode)
 	}
 
-	return body, nil
+	jiraPages.Inc()
+	return body, status, nil
 }
 
 func urlFromOptions(jql string, options *jira.SearchOptions) string {
@@ -142,6 +282,12 @@ func urlFromOptions(jql string, options *jira.SearchOptions) string {
 		if options.StartAt != 0 {
 			reqURL += fmt.Sprintf("&startAt=%d", options.StartAt)
 		}
+		if len(options.Expand) > 0 {
+			reqURL += fmt.Sprintf("&expand=%s", url.QueryEscape(options.Expand))
+		}
+		if len(options.Fields) > 0 {
+			reqURL += fmt.Sprintf("&fields=%s", url.QueryEscape(strings.Join(options.Fields, ",")))
+		}
 	}
 
 	return reqURL
@@ -170,8 +316,10 @@ func (extractor FieldExtractor) ExtractFromIssues(ctx context.Context, issues []
 	for _, issue := range issues {
 		i, err := extractor.extractFromIssue(ctx, issue)
 		if err != nil {
+			extractionErrors.Inc()
 			return nil, err
 		}
+		extractedIssues.Inc()
 		internal = append(internal, i)
 	}
 
@@ -185,9 +333,23 @@ func (extractor FieldExtractor) extractFromIssue(ctx context.Context, issue Issu
 	}
 	log.From(ctx).Debug("handling issue", zap.String("key", issueKey.(string)))
 
-	result := make(map[string]interface{})
+	result, err := extractor.extractRow(issue)
+	if err != nil {
+		return nil, err
+	}
+
+	if insertID := issue.InsertID(); len(insertID) > 0 {
+		result[insertIDKey] = insertID
+	}
+
+	return result, nil
+}
+
+// extractRow with the fields defined in the extractor from any Jira object
+func (extractor FieldExtractor) extractRow(from map[string]interface{}) (Issue, error) {
+	result := make(Issue)
 	for _, field := range extractor {
-		if err := extractor.extractField(field, issue, result); err != nil {
+		if err := extractor.extractField(field, from, result); err != nil {
 			return nil, err
 		}
 	}
@@ -207,6 +369,11 @@ func (extractor FieldExtractor) extractField(field FieldSchema, from, into map[s
 			return newPathError(fieldPath[i], fieldPath[:i])
 		}
 
+		// lists within the path of repeated fields get traversed element by element, resulting in a list of the values at the remaining path
+		if list, ok := cur.([]interface{}); ok && field.Repeated && i < len(fieldPath)-1 {
+			return extractor.extractFromList(field, fieldPath[i+1:], list, into)
+		}
+
 		if level, ok = cur.(map[string]interface{}); !ok {
 			if i < len(fieldPath)-1 && field.Required {
 				return newPathError(fieldPath[i], fieldPath[:i])
@@ -225,6 +392,30 @@ func (extractor FieldExtractor) extractField(field FieldSchema, from, into map[s
 	return nil
 }
 
+// extractFromList the values at path of each element into the field, elements without the path are skipped
+func (extractor FieldExtractor) extractFromList(field FieldSchema, path []string, list []interface{}, into map[string]interface{}) error {
+	element := FieldSchema{Name: field.Name, Path: strings.Join(path, ".")}
+
+	values := []interface{}{}
+	for _, item := range list {
+		from, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		extracted := make(map[string]interface{})
+		if err := extractor.extractField(element, from, extracted); err != nil {
+			return err
+		}
+		if value, ok := extracted[field.Name]; ok && value != nil {
+			values = append(values, value)
+		}
+	}
+
+	into[field.Name] = values
+	return nil
+}
+
 func newPathError(path string, fullPath []string) error {
 	return fmt.Errorf(
 		"path not found %v at %v",
@@ -1,8 +1,10 @@
 package function
 
-import "testing"
-
-import "encoding/json"
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
 
 func TestFieldExtractionHandlesEmptyRepeatedFields(t *testing.T) {
 
@@ -47,3 +49,57 @@ func TestFieldExtractionHandlesEmptyRepeatedFields(t *testing.T) {
 		t.Fatalf("got invalid field: %v\nexpected: %v", string(got), expect)
 	}
 }
+
+func TestFieldExtractionRecordsInsertID(t *testing.T) {
+	extractor := FieldExtractor([]FieldSchema{
+		FieldSchema{Name: "issue", Type: "string", Path: "key"},
+	})
+
+	issue := Issue{
+		"id":  "10001",
+		"key": "ABC-1",
+		"fields": map[string]interface{}{
+			"updated": "2019-11-12T10:00:00.000+0100",
+		},
+	}
+
+	extracted, err := extractor.ExtractFromIssues(context.Background(), []Issue{issue})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values, insertID, err := extracted[0].Save()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := "10001-2019-11-12T10:00:00.000+0100"; insertID != expect {
+		t.Fatalf("got invalid insert id: %v\nexpected: %v", insertID, expect)
+	}
+	if _, ok := values[insertIDKey]; ok {
+		t.Fatalf("insert id must not be part of the values: %v", values)
+	}
+}
+
+func TestFieldExtractionOnlyTraversesListsOfRepeatedFields(t *testing.T) {
+	var issue Issue
+	if err := json.Unmarshal([]byte(`{"key":"ABC-1","fields":{"components":[{"name":"api"},{"id":"2"},{"name":"web"}]}}`), &issue); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := FieldExtractor{
+		FieldSchema{Name: "components", Type: "string", Path: "fields.components.name", Repeated: true},
+		FieldSchema{Name: "component", Type: "string", Path: "fields.components.name"},
+	}.extractRow(issue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `{"component":null,"components":["api","web"]}`; string(encoded) != expect {
+		t.Fatalf("got invalid fields: %s\nexpected: %v", encoded, expect)
+	}
+}
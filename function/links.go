@@ -0,0 +1,136 @@
+package function
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/seibert-media/golibs/log"
+	"go.uber.org/zap"
+)
+
+const (
+	// OutwardLink points from the source to the target, e.g. `source blocks target` or `source has subtask target`
+	OutwardLink = "outward"
+	// InwardLink points from the target to the source, e.g. `source is blocked by target` or `source is subtask of target`
+	InwardLink = "inward"
+
+	// SubtaskLink is the type of links between a subtask and it's parent
+	SubtaskLink = "Subtask"
+	// EpicLink is the type of links between an epic and it's issues
+	EpicLink = "Epic"
+)
+
+// linkSchema of the `<table>_links` table, which contains an edge per link of an issue
+var linkSchema = []FieldSchema{
+	FieldSchema{Name: "id", Type: "STRING", Path: "id", Required: true},
+	FieldSchema{Name: "source", Type: "STRING", Path: "source", Required: true},
+	FieldSchema{Name: "target", Type: "STRING", Path: "target", Required: true},
+	FieldSchema{Name: "type", Type: "STRING", Path: "type", Required: true},
+	FieldSchema{Name: "direction", Type: "STRING", Path: "direction", Required: true},
+}
+
+// ExtractLinks from the issue's links, subtasks, parent and epic link field, which is omitted if empty
+func ExtractLinks(issue Issue, epicLinkField string) []Issue {
+	source := fmt.Sprint(issue["key"])
+	fields, _ := issue["fields"].(map[string]interface{})
+
+	var links []Issue
+	add := func(target interface{}, kind, direction string) {
+		key, _ := target.(string)
+		if len(key) < 1 {
+			return
+		}
+		links = append(links, Issue{
+			"id":        strings.Join([]string{source, kind, direction, key}, "|"),
+			"source":    source,
+			"target":    key,
+			"type":      kind,
+			"direction": direction,
+		})
+	}
+
+	issuelinks, _ := fields["issuelinks"].([]interface{})
+	for _, raw := range issuelinks {
+		link, _ := raw.(map[string]interface{})
+		kind, _ := link["type"].(map[string]interface{})
+		if outward, ok := link["outwardIssue"].(map[string]interface{}); ok {
+			add(outward["key"], fmt.Sprint(kind["name"]), OutwardLink)
+		}
+		if inward, ok := link["inwardIssue"].(map[string]interface{}); ok {
+			add(inward["key"], fmt.Sprint(kind["name"]), InwardLink)
+		}
+	}
+
+	subtasks, _ := fields["subtasks"].([]interface{})
+	for _, raw := range subtasks {
+		subtask, _ := raw.(map[string]interface{})
+		add(subtask["key"], SubtaskLink, OutwardLink)
+	}
+
+	if parent, ok := fields["parent"].(map[string]interface{}); ok {
+		add(parent["key"], SubtaskLink, InwardLink)
+	}
+
+	if len(epicLinkField) > 0 {
+		add(fields[epicLinkField], EpicLink, InwardLink)
+	}
+
+	return links
+}
+
+// writeLinks of the issues into the `<table>_links` table and return the amount of links written
+// Links of the issues which no longer exist in Jira get removed, if the sink supports it
+func writeLinks(ctx context.Context, env Environment, opts RunOptions, issues []Issue, at time.Time) (int, error) {
+	sink, err := openTable(ctx, env.dimension("links", "id"), opts)
+	if err != nil {
+		return 0, err
+	}
+	defer sink.Close()
+
+	if err := sink.Prepare(ctx, linkSchema); err != nil {
+		return 0, err
+	}
+
+	var rows []Issue
+	sources := make(map[string]bool, len(issues))
+	for _, issue := range issues {
+		sources[fmt.Sprint(issue["key"])] = true
+		rows = append(rows, ExtractLinks(issue, env.JiraEpicLinkField)...)
+	}
+	rows = uniqueRows(rows, "id")
+
+	inserted, err := sink.Write(ctx, rows)
+	if err != nil {
+		return inserted, err
+	}
+
+	reconciler, ok := sink.(Reconciler)
+	if !ok {
+		log.From(ctx).Info("sink does not support deleting rows, skipping removed links", zap.String("sink", fmt.Sprintf("%T", sink)))
+		return inserted, nil
+	}
+
+	log.From(ctx).Debug("reading stored links")
+	stored, err := reconciler.Keys(ctx)
+	if err != nil {
+		return inserted, err
+	}
+
+	// only the links of the fetched issues are known, so links of all other issues are kept
+	var candidates []string
+	for _, id := range stored {
+		if sources[strings.SplitN(id, "|", 2)[0]] {
+			candidates = append(candidates, id)
+		}
+	}
+
+	deleted, err := reconciler.Delete(ctx, missingKeys(candidates, rows, "id"), at)
+	if err != nil {
+		return inserted, err
+	}
+
+	log.From(ctx).Debug("deleted links", zap.Int("links", deleted))
+	return inserted, nil
+}
@@ -0,0 +1,42 @@
+package function
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestExtractLinks(t *testing.T) {
+	var issue Issue
+	if err := json.Unmarshal([]byte(`{
+		"key": "ABC-2",
+		"fields": {
+			"issuelinks": [
+				{"type": {"name": "Blocks", "inward": "is blocked by", "outward": "blocks"}, "outwardIssue": {"key": "ABC-3"}},
+				{"type": {"name": "Blocks", "inward": "is blocked by", "outward": "blocks"}, "inwardIssue": {"key": "XYZ-1"}}
+			],
+			"subtasks": [{"key": "ABC-4"}],
+			"parent": {"key": "ABC-1"},
+			"customfield_10008": "ABC-0",
+			"customfield_10009": null
+		}
+	}`), &issue); err != nil {
+		t.Fatal(err)
+	}
+
+	got := ExtractLinks(issue, "customfield_10008")
+	expect := []Issue{
+		Issue{"id": "ABC-2|Blocks|outward|ABC-3", "source": "ABC-2", "target": "ABC-3", "type": "Blocks", "direction": OutwardLink},
+		Issue{"id": "ABC-2|Blocks|inward|XYZ-1", "source": "ABC-2", "target": "XYZ-1", "type": "Blocks", "direction": InwardLink},
+		Issue{"id": "ABC-2|Subtask|outward|ABC-4", "source": "ABC-2", "target": "ABC-4", "type": SubtaskLink, "direction": OutwardLink},
+		Issue{"id": "ABC-2|Subtask|inward|ABC-1", "source": "ABC-2", "target": "ABC-1", "type": SubtaskLink, "direction": InwardLink},
+		Issue{"id": "ABC-2|Epic|inward|ABC-0", "source": "ABC-2", "target": "ABC-0", "type": EpicLink, "direction": InwardLink},
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got invalid links: %v\nexpected: %v", got, expect)
+	}
+
+	if got := ExtractLinks(issue, "customfield_10009"); len(got) != 4 {
+		t.Fatalf("got invalid amount of links without epic: %v\nexpected: %v", len(got), 4)
+	}
+}
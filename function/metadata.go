@@ -0,0 +1,184 @@
+package function
+
+import (
+	"context"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/seibert-media/golibs/log"
+	"go.uber.org/zap"
+)
+
+// syncedColumn contains the time a row of a metadata table was synced
+const syncedColumn = "synced_at"
+
+// metadataSchema of a metadata table, which contains the columns id, name and description followed by columns and syncedColumn
+func metadataSchema(columns ...FieldSchema) []FieldSchema {
+	schema := []FieldSchema{
+		FieldSchema{Name: "id", Type: "STRING", Path: "id", Required: true},
+		FieldSchema{Name: "name", Type: "STRING", Path: "name"},
+		FieldSchema{Name: "description", Type: "STRING", Path: "description"},
+	}
+	schema = append(schema, columns...)
+	return append(schema, FieldSchema{Name: syncedColumn, Type: "TIMESTAMP", Path: syncedColumn, Required: true})
+}
+
+var (
+	statusSchema = metadataSchema(
+		FieldSchema{Name: "category", Type: "STRING", Path: "category"},
+		FieldSchema{Name: "categoryName", Type: "STRING", Path: "categoryName"},
+	)
+	issueTypeSchema = metadataSchema(
+		FieldSchema{Name: "subtask", Type: "BOOLEAN", Path: "subtask"},
+	)
+	prioritySchema   = metadataSchema()
+	resolutionSchema = metadataSchema()
+	componentSchema  = metadataSchema(
+		FieldSchema{Name: "lead", Type: "STRING", Path: "lead"},
+	)
+	versionSchema = metadataSchema(
+		FieldSchema{Name: "archived", Type: "BOOLEAN", Path: "archived"},
+		FieldSchema{Name: "released", Type: "BOOLEAN", Path: "released"},
+		FieldSchema{Name: "startDate", Type: "DATE", Path: "startDate"},
+		FieldSchema{Name: "releaseDate", Type: "DATE", Path: "releaseDate"},
+	)
+)
+
+// SyncMetadata replaces the project's configuration in the tables `<table>_statuses`, `<table>_issue_types`,
+// `<table>_priorities`, `<table>_resolutions`, `<table>_components` and `<table>_versions`
+// The run is recorded in the executions of the issues table
+// In a dry run, the rows are printed to stdout instead and nothing gets created, written or recorded
+func SyncMetadata(ctx context.Context, env Environment, opts RunOptions) (err error) {
+	exec := Execution{Timestamp: time.Now().UTC(), Version: env.Version, Sync: MetadataSync}
+
+	sink, err := openRecorder(ctx, env, opts, MetadataSync)
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+	defer recordExecution(ctx, sink, &exec, &err)
+
+	log.From(ctx).Debug("creating jira client")
+	jira, err := NewJiraClient(ctx, env)
+	if err != nil {
+		log.From(ctx).Error("creating jira client", zap.Error(err))
+		return err
+	}
+
+	log.From(ctx).Info("fetching metadata")
+	tables, err := jira.Metadata(ctx)
+	if err != nil {
+		log.From(ctx).Error("fetching metadata", zap.Error(err))
+		return err
+	}
+
+	synced := exec.Timestamp.Format(jiraTimestamp)
+	policy := env.userPolicy()
+	for _, table := range tables {
+		for _, row := range table.rows {
+			row[syncedColumn] = synced
+			// the component lead is the only user within the metadata
+			policy.pseudonymize(row, nil, []string{"lead"})
+		}
+
+		if err := replaceTable(ctx, env.dimension(table.suffix, "id"), opts, table.schema, table.rows, &exec); err != nil {
+			log.From(ctx).Error("writing table", zap.String("table", table.suffix), zap.Error(err))
+			return err
+		}
+	}
+
+	log.From(ctx).Info("inserted", zap.Int("rows", exec.Inserted))
+	return nil
+}
+
+// metadataTable contains the rows of a metadata table
+type metadataTable struct {
+	suffix string
+	schema []FieldSchema
+	rows   []Issue
+}
+
+// Metadata of the client's project, statuses, priorities and resolutions are shared by all projects
+func (c JiraClient) Metadata(ctx context.Context) ([]metadataTable, error) {
+	log.From(ctx).Debug("reading statuses")
+	statuses, _, err := c.Status.GetAllStatuses()
+	if err != nil {
+		return nil, err
+	}
+
+	log.From(ctx).Debug("reading priorities")
+	priorities, _, err := c.Priority.GetList()
+	if err != nil {
+		return nil, err
+	}
+
+	log.From(ctx).Debug("reading resolutions")
+	resolutions, _, err := c.Resolution.GetList()
+	if err != nil {
+		return nil, err
+	}
+
+	log.From(ctx).Debug("reading project")
+	project, _, err := c.Client.Project.Get(c.Project)
+	if err != nil {
+		return nil, err
+	}
+
+	return metadataTables(statuses, priorities, resolutions, project), nil
+}
+
+// metadataTables converts the metadata returned by Jira into the rows of their tables
+func metadataTables(statuses []jira.Status, priorities []jira.Priority, resolutions []jira.Resolution, project *jira.Project) []metadataTable {
+	tables := []metadataTable{
+		{suffix: "statuses", schema: statusSchema},
+		{suffix: "issue_types", schema: issueTypeSchema},
+		{suffix: "priorities", schema: prioritySchema},
+		{suffix: "resolutions", schema: resolutionSchema},
+		{suffix: "components", schema: componentSchema},
+		{suffix: "versions", schema: versionSchema},
+	}
+
+	for _, status := range statuses {
+		tables[0].rows = append(tables[0].rows, Issue{
+			"id": status.ID, "name": status.Name, "description": status.Description,
+			"category": status.StatusCategory.Key, "categoryName": status.StatusCategory.Name,
+		})
+	}
+	for _, kind := range project.IssueTypes {
+		tables[1].rows = append(tables[1].rows, Issue{
+			"id": kind.ID, "name": kind.Name, "description": kind.Description, "subtask": kind.Subtask,
+		})
+	}
+	for _, priority := range priorities {
+		tables[2].rows = append(tables[2].rows, Issue{
+			"id": priority.ID, "name": priority.Name, "description": priority.Description,
+		})
+	}
+	for _, resolution := range resolutions {
+		tables[3].rows = append(tables[3].rows, Issue{
+			"id": resolution.ID, "name": resolution.Name, "description": resolution.Description,
+		})
+	}
+	for _, component := range project.Components {
+		tables[4].rows = append(tables[4].rows, Issue{
+			"id": component.ID, "name": component.Name, "description": component.Description, "lead": component.Lead.DisplayName,
+		})
+	}
+	for _, version := range project.Versions {
+		tables[5].rows = append(tables[5].rows, Issue{
+			"id": version.ID, "name": version.Name, "description": version.Description,
+			"archived": version.Archived, "released": version.Released,
+			"startDate": nullable(version.StartDate), "releaseDate": nullable(version.ReleaseDate),
+		})
+	}
+
+	return tables
+}
+
+// nullable returns nil for empty strings, as BigQuery does not accept them for most types
+func nullable(value string) interface{} {
+	if len(value) < 1 {
+		return nil
+	}
+	return value
+}
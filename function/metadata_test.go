@@ -0,0 +1,107 @@
+package function
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	jira "github.com/andygrunwald/go-jira"
+)
+
+func TestMetadataTables(t *testing.T) {
+	tables := metadataTables(
+		[]jira.Status{jira.Status{ID: "1", Name: "Open", StatusCategory: jira.StatusCategory{Key: "new", Name: "To Do"}}},
+		nil,
+		nil,
+		&jira.Project{Versions: []jira.Version{jira.Version{ID: "10", Name: "1.0", Released: true, ReleaseDate: "2019-11-12"}}},
+	)
+
+	for _, table := range tables {
+		if table.suffix == "statuses" {
+			expect := []Issue{Issue{"id": "1", "name": "Open", "description": "", "category": "new", "categoryName": "To Do"}}
+			if !reflect.DeepEqual(table.rows, expect) {
+				t.Fatalf("got invalid statuses: %v\nexpected: %v", table.rows, expect)
+			}
+		}
+		if table.suffix == "versions" {
+			expect := []Issue{Issue{
+				"id": "10", "name": "1.0", "description": "", "archived": false, "released": true,
+				"startDate": nil, "releaseDate": "2019-11-12",
+			}}
+			if !reflect.DeepEqual(table.rows, expect) {
+				t.Fatalf("got invalid versions: %v\nexpected: %v", table.rows, expect)
+			}
+		}
+		if table.suffix == "priorities" && len(table.rows) > 0 {
+			t.Fatalf("got invalid priorities: %v\nexpected: %v", table.rows, "none")
+		}
+	}
+}
+
+func TestSyncMetadataHashesComponentLead(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rest/api/2/status", "/rest/api/2/priority", "/rest/api/2/resolution":
+			w.Write([]byte(`[]`))
+		case "/rest/api/2/project/ABC":
+			w.Write([]byte(`{"key":"ABC","components":[{"id":"1","name":"Backend","lead":{"name":"jdoe","displayName":"Jane Doe"}}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	auth, err := json.Marshal(JiraAuth{URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := Environment{
+		JiraAuthSecret: string(auth),
+		JiraProject:    "ABC",
+		Sink:           NDJSONSink,
+		SinkPath:       dir,
+		SchemaPath:     filepath.Join(dir, "schema.json"),
+		UserPolicy:     HashUsers,
+		UserSalt:       "salt",
+	}
+	if err := ioutil.WriteFile(env.SchemaPath, []byte(`[{"name":"issue","type":"STRING","path":"key"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SyncMetadata(context.Background(), env, RunOptions{Sync: MetadataSync}); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(filepath.Join(dir, "issues_components.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var leads []interface{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var row map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			t.Fatal(err)
+		}
+		leads = append(leads, row["lead"])
+	}
+
+	if expect := []interface{}{env.userPolicy().hash("Jane Doe")}; !reflect.DeepEqual(leads, expect) {
+		t.Fatalf("got invalid leads: %v\nexpected: %v", leads, expect)
+	}
+}
@@ -0,0 +1,145 @@
+package function
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/seibert-media/golibs/log"
+	"go.uber.org/zap"
+)
+
+// metricsJob is the job name metrics are pushed to the Pushgateway with
+const metricsJob = "jigquery"
+
+// Metrics of the runs, which are kept apart from the runtime metrics of the default registry so only they get pushed
+var Metrics = prometheus.NewRegistry()
+
+var (
+	jiraRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "jigquery_jira_requests_total",
+		Help: "Search requests sent to Jira by status code, 0 if no response was received",
+	}, []string{"status"})
+	jiraRequestDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "jigquery_jira_request_duration_seconds",
+		Help:    "Latency of search requests sent to Jira",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 10),
+	})
+	jiraRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "jigquery_jira_retries_total",
+		Help: "Retried search requests by the status code of the failed attempt, 0 if no response was received",
+	}, []string{"status"})
+	jiraPages = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "jigquery_jira_pages_total",
+		Help: "Pages of search results read from Jira",
+	})
+	jiraDeadlines = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "jigquery_jira_deadlines_total",
+		Help: "Searches stopped at the run deadline before reading all pages",
+	})
+
+	extractedIssues = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "jigquery_extracted_issues_total",
+		Help: "Issues extracted into rows by the schema",
+	})
+	extractionErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "jigquery_extraction_errors_total",
+		Help: "Issues failing to be extracted into rows by the schema",
+	})
+
+	insertedRows = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "jigquery_bigquery_inserted_rows_total",
+		Help: "Rows inserted into BigQuery by table",
+	}, []string{"table"})
+	rejectedRowsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "jigquery_bigquery_rejected_rows_total",
+		Help: "Rows BigQuery failed to insert by table",
+	}, []string{"table"})
+	insertDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "jigquery_bigquery_insert_duration_seconds",
+		Help:    "Latency of inserting rows into BigQuery by table",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+	}, []string{"table"})
+	insertRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "jigquery_bigquery_insert_retries_total",
+		Help: "Retried streaming insert chunks by table",
+	}, []string{"table"})
+	recordDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "jigquery_bigquery_record_execution_duration_seconds",
+		Help:    "Latency of recording executions in BigQuery by result",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 8),
+	}, []string{"result"})
+
+	executions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "jigquery_executions_total",
+		Help: "Finished executions by sync and status",
+	}, []string{"sync", "status"})
+	lastExecution = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "jigquery_last_execution_timestamp_seconds",
+		Help: "Start of the last finished execution by sync and status",
+	}, []string{"sync", "status"})
+	lastExecutionRows = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "jigquery_last_execution_rows",
+		Help: "Rows of the last finished execution by sync and result, e.g. to alert on runs inserting no rows",
+	}, []string{"sync", "result"})
+)
+
+func init() {
+	Metrics.MustRegister(
+		jiraRequests, jiraRequestDuration, jiraRetries, jiraPages, jiraDeadlines,
+		extractedIssues, extractionErrors,
+		insertedRows, rejectedRowsTotal, insertDuration, insertRetries, recordDuration,
+		executions, lastExecution, lastExecutionRows,
+	)
+}
+
+// observeExecution in the execution metrics once it finished
+func observeExecution(exec Execution) {
+	sync := exec.Sync
+	if len(sync) < 1 {
+		sync = IssuesSync
+	}
+
+	executions.WithLabelValues(sync, exec.Status).Inc()
+	lastExecution.WithLabelValues(sync, exec.Status).Set(float64(exec.Timestamp.Unix()))
+	for result, rows := range map[string]int{
+		"fetched":  exec.Fetched,
+		"inserted": exec.Inserted,
+		"rejected": exec.Rejected,
+		"deleted":  exec.Deleted,
+	} {
+		lastExecutionRows.WithLabelValues(sync, result).Set(float64(rows))
+	}
+}
+
+// observeRequest to Jira, which received the status code or none if it is 0
+func observeRequest(start time.Time, status int) {
+	jiraRequests.WithLabelValues(strconv.Itoa(status)).Inc()
+	jiraRequestDuration.Observe(time.Since(start).Seconds())
+}
+
+// observeInsert of rows into table, which failed with err, see rejectedRows
+func observeInsert(table string, start time.Time, rows, inserted int, err error) {
+	insertedRows.WithLabelValues(table).Add(float64(inserted))
+	rejectedRowsTotal.WithLabelValues(table).Add(float64(rejectedRows(rows, inserted, err)))
+	insertDuration.WithLabelValues(table).Observe(time.Since(start).Seconds())
+}
+
+// pushMetrics to the environment's Pushgateway if set, as functions do not live long enough to be scraped
+// A failed push is only logged, so it does not fail the run, and dry runs are not pushed
+func pushMetrics(ctx context.Context, env Environment, opts RunOptions) {
+	if len(env.Pushgateway) < 1 || opts.DryRun {
+		return
+	}
+
+	log.From(ctx).Debug("pushing metrics", zap.String("pushgateway", env.Pushgateway))
+	if err := push.New(env.Pushgateway, metricsJob).
+		Gatherer(Metrics).
+		Grouping("project", env.JiraProject).
+		Grouping("table", env.tableName()).
+		Push(); err != nil {
+		log.From(ctx).Error("pushing metrics", zap.Error(err))
+	}
+}
@@ -0,0 +1,161 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	jira "github.com/andygrunwald/go-jira"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRunMetrics(t *testing.T) {
+	jira := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/api/2/search" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"startAt":0,"maxResults":500,"total":2,"issues":[{"id":"1","key":"ABC-1","fields":{}},{"id":"2","key":"ABC-2","fields":{}}]}`))
+	}))
+	defer jira.Close()
+
+	var pushed []string
+	pushgateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pushed = append(pushed, r.URL.Path)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer pushgateway.Close()
+
+	dir, err := ioutil.TempDir("", "metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	auth, err := json.Marshal(JiraAuth{URL: jira.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := Environment{
+		JiraAuthSecret: string(auth),
+		JiraProject:    "ABC",
+		Sink:           NDJSONSink,
+		SinkPath:       dir,
+		SchemaPath:     filepath.Join(dir, "schema.json"),
+		Pushgateway:    pushgateway.URL,
+	}
+	if err := ioutil.WriteFile(env.SchemaPath, []byte(`[{"name":"issue","type":"STRING","path":"key","required":true}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pages := testutil.ToFloat64(jiraPages)
+	extracted := testutil.ToFloat64(extractedIssues)
+
+	if _, err := RunSummary(context.Background(), env, RunOptions{JQL: "project = ABC"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := testutil.ToFloat64(jiraPages) - pages; got != 1 {
+		t.Fatalf("got invalid amount of pages: %v\nexpected: %v", got, 1)
+	}
+	if got := testutil.ToFloat64(extractedIssues) - extracted; got != 2 {
+		t.Fatalf("got invalid amount of extracted issues: %v\nexpected: %v", got, 2)
+	}
+	if got := testutil.ToFloat64(jiraRequests.WithLabelValues("200")); got < 1 {
+		t.Fatalf("got invalid amount of requests: %v\nexpected: %v", got, "at least 1")
+	}
+	if got := testutil.ToFloat64(lastExecutionRows.WithLabelValues(IssuesSync, "inserted")); got != 2 {
+		t.Fatalf("got invalid inserted rows of the last execution: %v\nexpected: %v", got, 2)
+	}
+
+	// the order of the grouping labels within the path is not defined
+	expect := "/metrics/job/jigquery/project/ABC/table/issues"
+	if len(pushed) != 1 || !reflect.DeepEqual(pushGrouping(pushed[0]), pushGrouping(expect)) {
+		t.Fatalf("got invalid pushes: %v\nexpected: %v", pushed, expect)
+	}
+
+	// the daemon serves the same metrics
+	server := httptest.NewServer((&Daemon{}).Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `jigquery_last_execution_rows{result="inserted",sync="issues"} 2`; !strings.Contains(string(body), expect) {
+		t.Fatalf("got invalid metrics: %s\nexpected: %v", body, expect)
+	}
+}
+
+// pushGrouping of a push to the Pushgateway, which are the label pairs following /metrics in it's path
+func pushGrouping(path string) map[string]string {
+	grouping := map[string]string{}
+	parts := strings.Split(strings.TrimPrefix(path, "/metrics/"), "/")
+	for i := 0; i+1 < len(parts); i += 2 {
+		grouping[parts[i]] = parts[i+1]
+	}
+	return grouping
+}
+
+func TestJiraSearchRetries(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		status   int
+		failures int
+		requests int
+		retries  float64
+		err      bool
+	}{
+		{name: "throttled", status: http.StatusTooManyRequests, failures: 1, requests: 2, retries: 1},
+		{name: "unavailable", status: http.StatusServiceUnavailable, failures: 2, requests: 3, retries: 2},
+		{name: "exhausted", status: http.StatusBadGateway, failures: 3, requests: 3, retries: 2, err: true},
+		{name: "bad request", status: http.StatusBadRequest, failures: 1, requests: 1, err: true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests <= c.failures {
+					w.WriteHeader(c.status)
+					return
+				}
+				w.Write([]byte(`{"startAt":0,"maxResults":50,"total":1,"issues":[{"id":"1","key":"ABC-1","fields":{}}]}`))
+			}))
+			defer server.Close()
+
+			client, err := NewJiraClient(context.Background(), Environment{JiraAuthSecret: fmt.Sprintf(`{"url":%q}`, server.URL), JiraProject: "ABC"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			retries := testutil.ToFloat64(jiraRetries.WithLabelValues(strconv.Itoa(c.status)))
+
+			issues, err := client.Search(context.Background(), "project = ABC", &jira.SearchOptions{})
+			if (err != nil) != c.err {
+				t.Fatalf("got invalid error: %v\nexpected error: %v", err, c.err)
+			}
+			if !c.err && len(issues) != 1 {
+				t.Fatalf("got invalid issues: %v\nexpected: %v", len(issues), 1)
+			}
+			if requests != c.requests {
+				t.Fatalf("got invalid amount of requests: %v\nexpected: %v", requests, c.requests)
+			}
+			if got := testutil.ToFloat64(jiraRetries.WithLabelValues(strconv.Itoa(c.status))) - retries; got != c.retries {
+				t.Fatalf("got invalid amount of retries: %v\nexpected: %v", got, c.retries)
+			}
+		})
+	}
+}
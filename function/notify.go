@@ -0,0 +1,203 @@
+package function
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/seibert-media/golibs/log"
+	"go.uber.org/zap"
+)
+
+const (
+	// NotifyFailure notifies about failed runs, this is the default
+	NotifyFailure = "failure"
+	// NotifySuccess notifies about successful runs
+	NotifySuccess = "success"
+	// NotifyEmpty notifies once the issues runs inserted no rows for NOTIFY_EMPTY_RUNS consecutive runs
+	NotifyEmpty = "empty"
+)
+
+const (
+	// WebhookFormat posts the Notification as JSON, this is the default
+	WebhookFormat = "webhook"
+	// SlackFormat posts a message to a Slack incoming webhook
+	SlackFormat = "slack"
+	// GoogleChatFormat posts a message to a Google Chat incoming webhook
+	GoogleChatFormat = "googlechat"
+	// TeamsFormat posts a message card to a Microsoft Teams incoming webhook
+	TeamsFormat = "teams"
+)
+
+// notifyTimeout of a request to the webhook
+const notifyTimeout = 10 * time.Second
+
+// Notification about a run, as posted to generic webhooks
+type Notification struct {
+	Event   string  `json:"event"`
+	Project string  `json:"project"`
+	Table   string  `json:"table"`
+	Summary Summary `json:"summary"`
+	// EmptyRuns is the amount of consecutive runs which inserted no rows for NotifyEmpty
+	EmptyRuns int `json:"emptyRuns,omitempty"`
+}
+
+// Notify the environment's webhook about a run, if the run matches the events it is configured for
+// Failed notifications are only logged, so they do not fail the run
+func Notify(ctx context.Context, env Environment, summary Summary) {
+	if len(env.NotifyWebhook) < 1 {
+		return
+	}
+
+	notification, ok, err := newNotification(ctx, env, summary)
+	if err != nil {
+		log.From(ctx).Error("checking empty runs", zap.Error(err))
+		return
+	}
+	if !ok {
+		return
+	}
+
+	log.From(ctx).Info("notifying", zap.String("event", notification.Event), zap.String("format", env.NotifyFormat))
+	if err := notification.Send(ctx, env.NotifyWebhook, env.NotifyFormat); err != nil {
+		log.From(ctx).Error("notifying", zap.Error(err))
+	}
+}
+
+// newNotification about the run, if it matches the events the environment is configured for
+func newNotification(ctx context.Context, env Environment, summary Summary) (Notification, bool, error) {
+	notification := Notification{Project: env.JiraProject, Table: env.tableName(), Summary: summary}
+
+	switch {
+	case summary.Status == ExecutionFailed:
+		notification.Event = NotifyFailure
+		return notification, env.notifies(NotifyFailure), nil
+	case summary.Sync == IssuesSync && summary.Inserted < 1 && env.NotifyEmptyRuns > 0:
+		crossed, err := emptyRunsCrossed(ctx, env)
+		if err != nil {
+			return notification, false, err
+		}
+		if crossed {
+			notification.Event = NotifyEmpty
+			notification.EmptyRuns = env.NotifyEmptyRuns
+			return notification, true, nil
+		}
+	}
+
+	notification.Event = NotifySuccess
+	return notification, env.notifies(NotifySuccess), nil
+}
+
+// emptyRunsCrossed reports whether the last issues run was the NOTIFY_EMPTY_RUNS consecutive one which inserted no rows,
+// so the notification is only sent once per streak of empty runs
+func emptyRunsCrossed(ctx context.Context, env Environment) (bool, error) {
+	sink, err := NewSink(ctx, env)
+	if err != nil {
+		return false, err
+	}
+	defer sink.Close()
+	history, ok := sink.(ExecutionHistory)
+	if !ok {
+		log.From(ctx).Warn("checking empty runs", zap.String("sink", env.Sink), zap.String("reason", "unsupported by sink"))
+		return false, nil
+	}
+
+	recent, err := history.RecentExecutions(ctx, IssuesSync, env.NotifyEmptyRuns+1)
+	if err != nil {
+		return false, err
+	}
+
+	empty := 0
+	for _, exec := range recent {
+		if exec.Status != ExecutionSucceeded || exec.Inserted > 0 {
+			break
+		}
+		empty++
+	}
+
+	return empty == env.NotifyEmptyRuns, nil
+}
+
+// title of the notification's message
+func (n Notification) title() string {
+	sync := n.Summary.Sync
+	switch n.Event {
+	case NotifyFailure:
+		return fmt.Sprintf("jigquery %s: %s run failed", n.Project, sync)
+	case NotifyEmpty:
+		return fmt.Sprintf("jigquery %s: %s runs inserted no rows %d times in a row", n.Project, sync, n.EmptyRuns)
+	}
+	return fmt.Sprintf("jigquery %s: %s run succeeded", n.Project, sync)
+}
+
+// lines of the notification's message, containing the table, counts and error of the run
+func (n Notification) lines() []string {
+	lines := []string{
+		fmt.Sprintf("table: %s", n.Table),
+		fmt.Sprintf("fetched: %d, inserted: %d, rejected: %d, deleted: %d, duration: %.1fs",
+			n.Summary.Fetched, n.Summary.Inserted, n.Summary.Rejected, n.Summary.Deleted, n.Summary.Duration),
+	}
+	if len(n.Summary.Error) > 0 {
+		lines = append(lines, fmt.Sprintf("error: %s", n.Summary.Error))
+	}
+	return lines
+}
+
+// payload of the notification in the webhook's format
+func (n Notification) payload(format string) interface{} {
+	switch format {
+	case SlackFormat, GoogleChatFormat:
+		return map[string]string{"text": strings.Join(append([]string{n.title()}, n.lines()...), "\n")}
+	case TeamsFormat:
+		color := "2EB886"
+		switch n.Event {
+		case NotifyFailure:
+			color = "D13438"
+		case NotifyEmpty:
+			color = "E3A21A"
+		}
+		// teams only breaks lines at paragraphs
+		return map[string]string{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    n.title(),
+			"title":      n.title(),
+			"text":       strings.Join(n.lines(), "\n\n"),
+			"themeColor": color,
+		}
+	}
+	return n
+}
+
+// Send the notification to the webhook in the format
+func (n Notification) Send(ctx context.Context, webhook, format string) error {
+	body, err := json.Marshal(n.payload(format))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("posting notification: status %v", resp.StatusCode)
+	}
+
+	return nil
+}
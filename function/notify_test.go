@@ -0,0 +1,197 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotificationPayload(t *testing.T) {
+	notification := Notification{
+		Event:   NotifyFailure,
+		Project: "ABC",
+		Table:   "issues",
+		Summary: Summary{Sync: IssuesSync, Status: ExecutionFailed, Error: "searching issues: status 401", Fetched: 3},
+	}
+
+	for _, c := range []struct {
+		format string
+		key    string
+		expect string
+	}{
+		{SlackFormat, "text", "jigquery ABC: issues run failed\ntable: issues\nfetched: 3, inserted: 0, rejected: 0, deleted: 0, duration: 0.0s\nerror: searching issues: status 401"},
+		{GoogleChatFormat, "text", "jigquery ABC: issues run failed\ntable: issues\nfetched: 3, inserted: 0, rejected: 0, deleted: 0, duration: 0.0s\nerror: searching issues: status 401"},
+		{TeamsFormat, "themeColor", "D13438"},
+		{TeamsFormat, "text", "table: issues\n\nfetched: 3, inserted: 0, rejected: 0, deleted: 0, duration: 0.0s\n\nerror: searching issues: status 401"},
+		{"", "event", NotifyFailure},
+	} {
+		encoded, err := json.Marshal(notification.payload(c.format))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var payload map[string]interface{}
+		if err := json.Unmarshal(encoded, &payload); err != nil {
+			t.Fatal(err)
+		}
+		if got := payload[c.key]; got != c.expect {
+			t.Fatalf("got invalid %s of %q payload: %v\nexpected: %v", c.key, c.format, got, c.expect)
+		}
+	}
+}
+
+func TestEnvironmentNotifies(t *testing.T) {
+	for _, c := range []struct {
+		on      string
+		failure bool
+		success bool
+	}{
+		{"", true, false},
+		{"success", false, true},
+		{"failure, success", true, true},
+	} {
+		env := Environment{NotifyOn: c.on}
+		if env.notifies(NotifyFailure) != c.failure || env.notifies(NotifySuccess) != c.success {
+			t.Fatalf("got invalid events for %q: %v, %v\nexpected: %v, %v", c.on, env.notifies(NotifyFailure), env.notifies(NotifySuccess), c.failure, c.success)
+		}
+	}
+
+	if err := (Environment{NotifyOn: "always"}).validateNotify(); err == nil {
+		t.Fatalf("got invalid error: %v\nexpected: %v", err, "unknown event")
+	}
+}
+
+func TestNotifyEmptyRuns(t *testing.T) {
+	jira := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/api/2/search" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"startAt":0,"maxResults":500,"total":0,"issues":[]}`))
+	}))
+	defer jira.Close()
+
+	var notifications []Notification
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification Notification
+		if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		notifications = append(notifications, notification)
+	}))
+	defer webhook.Close()
+
+	dir, err := ioutil.TempDir("", "notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	auth, err := json.Marshal(JiraAuth{URL: jira.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := Environment{
+		JiraAuthSecret:  string(auth),
+		JiraProject:     "ABC",
+		Sink:            NDJSONSink,
+		SinkPath:        dir,
+		SchemaPath:      filepath.Join(dir, "schema.json"),
+		NotifyWebhook:   webhook.URL,
+		NotifyEmptyRuns: 2,
+	}
+	if err := ioutil.WriteFile(env.SchemaPath, []byte(`[{"name":"issue","type":"STRING","path":"key"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the streak starts after the last run which inserted rows
+	sink := &FileSink{Dir: dir, Table: "issues", Format: NDJSONSink}
+	if err := sink.RecordExecution(ctx, Execution{Timestamp: time.Now().Add(-time.Hour).UTC(), Status: ExecutionSucceeded, Inserted: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []string
+	for i := 0; i < 3; i++ {
+		notifications = nil
+		if _, err := RunSummary(ctx, env, RunOptions{JQL: "project = ABC"}); err != nil {
+			t.Fatal(err)
+		}
+		for _, notification := range notifications {
+			events = append(events, notification.Event)
+		}
+	}
+
+	// only the second run crosses the threshold, the others neither failed nor are notified on success
+	if expect := []string{NotifyEmpty}; !reflect.DeepEqual(events, expect) {
+		t.Fatalf("got invalid notifications: %v\nexpected: %v", events, expect)
+	}
+
+	recent, err := sink.RecentExecutions(ctx, IssuesSync, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != 4 || recent[3].Inserted != 3 {
+		t.Fatalf("got invalid recent executions: %+v\nexpected: %v", recent, "3 empty runs followed by the initial one")
+	}
+
+	// failures are notified by default
+	notifications = nil
+	env.SchemaPath = filepath.Join(dir, "missing.json")
+	if _, err := RunSummary(ctx, env, RunOptions{}); err == nil {
+		t.Fatalf("got invalid error: %v\nexpected: %v", err, "missing schema")
+	}
+	if len(notifications) != 1 || notifications[0].Event != NotifyFailure || !strings.Contains(notifications[0].Summary.Error, "missing.json") {
+		t.Fatalf("got invalid notifications: %+v\nexpected: %v", notifications, "a failure")
+	}
+}
+
+func TestEmptyRunsCrossedInDatabase(t *testing.T) {
+	dsn, cleanup := testDatabase(t)
+	defer cleanup()
+	sink := newTestDatabaseSink(t, dsn)
+	defer sink.DB.Close()
+
+	ctx := context.Background()
+	if err := sink.Prepare(ctx, []FieldSchema{FieldSchema{Name: "issue", Type: "STRING", Path: "key", Required: true}}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Add(-time.Hour).UTC()
+	for i, c := range []struct {
+		exec    Execution
+		runs    int
+		crossed bool
+	}{
+		{Execution{Sync: IssuesSync, Status: ExecutionSucceeded, Inserted: 3}, 1, false},
+		// runs of other syncs do not belong to the streak, runs recorded without sync do
+		{Execution{Sync: CommentsSync, Status: ExecutionSucceeded}, 1, false},
+		{Execution{Status: ExecutionSucceeded}, 1, true},
+		{Execution{Sync: IssuesSync, Status: ExecutionSucceeded}, 2, true},
+		{Execution{Sync: IssuesSync, Status: ExecutionSucceeded}, 2, false},
+		// a failed run ends the streak
+		{Execution{Sync: IssuesSync, Status: ExecutionFailed}, 1, false},
+		{Execution{Sync: IssuesSync, Status: ExecutionSucceeded}, 1, true},
+	} {
+		c.exec.Timestamp = start.Add(time.Duration(i) * time.Minute)
+		if err := sink.RecordExecution(ctx, c.exec); err != nil {
+			t.Fatal(err)
+		}
+
+		crossed, err := emptyRunsCrossed(ctx, Environment{Sink: SQLSink, SinkDriver: "sqlite3", SinkPath: dsn, NotifyEmptyRuns: c.runs})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if crossed != c.crossed {
+			t.Fatalf("got invalid crossing after execution %d with %d empty runs: %v\nexpected: %v", i, c.runs, crossed, c.crossed)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package function
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// MonthWindow splits a backfill into months, this is the default
+	MonthWindow = "month"
+	// WeekWindow splits a backfill into weeks
+	WeekWindow = "week"
+	// DayWindow splits a backfill into days
+	DayWindow = "day"
+)
+
+const (
+	// IssuesSync writes the issues updated since the last run, this is the default
+	IssuesSync = "issues"
+	// ReconcileSync removes issues from the sink which no longer exist in Jira
+	ReconcileSync = "reconcile"
+	// WorklogsSync writes the worklogs changed since the last run into the worklogs table
+	WorklogsSync = "worklogs"
+	// CommentsSync writes the comments of the issues updated since the last run into the comments table
+	CommentsSync = "comments"
+	// AgileSync replaces the board, sprint and sprint membership tables with the current state of Jira Software
+	AgileSync = "agile"
+	// MetadataSync replaces the tables containing the project's statuses, issue types, priorities, resolutions, components and versions
+	MetadataSync = "metadata"
+	// BackfillSync writes all issues updated within a time range, window by window
+	BackfillSync = "backfill"
+	// ReprocessSync extracts the issues stored in the archive again, without querying Jira
+	ReprocessSync = "reprocess"
+)
+
+// RunOptions modify a single run, e.g. as sent in the Pub/Sub message triggering it
+type RunOptions struct {
+	// DryRun prints the rows and DDL instead of writing anything
+	DryRun bool `json:"dryRun,omitempty"`
+	// Format of the printed rows in a DryRun, either `table` (default) or `ndjson`
+	Format string `json:"format,omitempty"`
+	// Sync selects what the run synchronizes, IssuesSync by default
+	Sync string `json:"sync,omitempty"`
+
+	// JQL replaces the query of an IssuesSync, e.g. to fetch some issues again
+	JQL string `json:"jql,omitempty"`
+	// FullResync fetches all issues in an IssuesSync, ignoring the last checkpoint
+	FullResync bool `json:"fullResync,omitempty"`
+
+	// Since is the start of the range of a BackfillSync or an IssuesSync,
+	// either a date like `2019-01-01` or a RFC 3339 timestamp
+	Since string `json:"since,omitempty"`
+	// Until is the end of the range, the time of the run by default
+	Until string `json:"until,omitempty"`
+	// Cursor restricts an ad-hoc IssuesSync to the issues updated at or after this RFC 3339 timestamp,
+	// as set by the continuation of a run reaching it's deadline
+	Cursor string `json:"cursor,omitempty"`
+
+	// After continues a ReprocessSync after the archived version of this name, as set by the continuation of a run reaching it's deadline
+	After string `json:"after,omitempty"`
+
+	// Window a BackfillSync's range is split into, either MonthWindow (default), WeekWindow or DayWindow
+	Window string `json:"window,omitempty"`
+}
+
+// ParseRunOptions from their JSON representation, an empty payload results in the default options
+// Unknown options are rejected, so a misspelled option does not silently result in a regular run
+func ParseRunOptions(data []byte) (RunOptions, error) {
+	var opts RunOptions
+	if len(bytes.TrimSpace(data)) < 1 {
+		return opts, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&opts); err != nil {
+		return RunOptions{}, fmt.Errorf("parsing run options: %v", err)
+	}
+
+	return opts, opts.Validate()
+}
+
+// adhoc reports whether the options select only some of the issues of an IssuesSync
+func (o RunOptions) adhoc() bool {
+	return len(o.JQL) > 0 || len(o.Since) > 0 || len(o.Until) > 0
+}
+
+// Validate the options
+func (o RunOptions) Validate() error {
+	switch o.Format {
+	case "", TableFormat, NDJSONFormat:
+	default:
+		return fmt.Errorf("invalid run option: format: unknown format %q", o.Format)
+	}
+
+	switch o.Sync {
+	case "", IssuesSync, ReconcileSync, WorklogsSync, CommentsSync, AgileSync, MetadataSync, BackfillSync, ReprocessSync:
+	default:
+		return fmt.Errorf("invalid run option: sync: unknown sync %q", o.Sync)
+	}
+
+	switch o.Window {
+	case "", MonthWindow, WeekWindow, DayWindow:
+	default:
+		return fmt.Errorf("invalid run option: window: unknown window %q", o.Window)
+	}
+
+	issues := len(o.Sync) < 1 || o.Sync == IssuesSync
+	if len(o.JQL) > 0 && !issues {
+		return fmt.Errorf("invalid run option: jql: only supported for sync %q", IssuesSync)
+	}
+	if o.FullResync && !issues {
+		return fmt.Errorf("invalid run option: fullResync: only supported for sync %q", IssuesSync)
+	}
+	if len(o.JQL) > 0 && (o.FullResync || len(o.Since) > 0 || len(o.Until) > 0) {
+		return fmt.Errorf("invalid run option: jql: can not be combined with fullResync, since or until")
+	}
+	if o.FullResync && (len(o.Since) > 0 || len(o.Until) > 0) {
+		return fmt.Errorf("invalid run option: fullResync: can not be combined with since or until")
+	}
+	if (len(o.Since) > 0 || len(o.Until) > 0) && !issues && o.Sync != BackfillSync {
+		return fmt.Errorf("invalid run option: since: only supported for syncs %q and %q", IssuesSync, BackfillSync)
+	}
+	if _, err := o.cursor(); err != nil {
+		return err
+	}
+	if len(o.Cursor) > 0 && (!issues || !o.adhoc()) {
+		return fmt.Errorf("invalid run option: cursor: only supported for sync %q with jql, since or until", IssuesSync)
+	}
+	if len(o.After) > 0 && o.Sync != ReprocessSync {
+		return fmt.Errorf("invalid run option: after: only supported for sync %q", ReprocessSync)
+	}
+	if len(o.Window) > 0 && o.Sync != BackfillSync {
+		return fmt.Errorf("invalid run option: window: only supported for sync %q", BackfillSync)
+	}
+
+	if o.Sync == BackfillSync && len(o.Since) < 1 {
+		return fmt.Errorf("invalid run option: since: required for sync %q", BackfillSync)
+	}
+
+	since, until, err := o.Range(time.Now())
+	if err != nil {
+		return err
+	}
+	if !since.Before(until) {
+		return fmt.Errorf("invalid run option: since: %s is not before until %s", since.Format(time.RFC3339), until.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// validateMode of the environment's table, snapshots have to contain all issues, so a run can not select only some of them
+func (o RunOptions) validateMode(mode string) error {
+	if mode != SnapshotMode {
+		return nil
+	}
+	if len(o.JQL) > 0 || len(o.Since) > 0 || len(o.Until) > 0 {
+		return fmt.Errorf("invalid run option: jql, since and until are not supported in %s mode, as they would replace the snapshot with some of the issues", SnapshotMode)
+	}
+	return nil
+}
+
+// cursor of the options, the zero time if not set
+func (o RunOptions) cursor() (time.Time, error) {
+	if len(o.Cursor) < 1 {
+		return time.Time{}, nil
+	}
+
+	cursor, err := time.Parse(time.RFC3339, o.Cursor)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid run option: cursor: expected a RFC 3339 timestamp: %q", o.Cursor)
+	}
+
+	return cursor.UTC(), nil
+}
+
+// Range of the options, until defaults to now
+func (o RunOptions) Range(now time.Time) (since, until time.Time, err error) {
+	if since, err = parseBound(o.Since); err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid run option: since: %v", err)
+	}
+
+	until = now.UTC()
+	if len(o.Until) > 0 {
+		if until, err = parseBound(o.Until); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid run option: until: %v", err)
+		}
+	}
+
+	return since, until, nil
+}
+
+// parseBound of a range, either a date like `2019-01-01` in UTC or a RFC 3339 timestamp
+// An empty value results in the zero time
+func parseBound(value string) (time.Time, error) {
+	if len(value) < 1 {
+		return time.Time{}, nil
+	}
+
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected a date like 2019-01-01 or a RFC 3339 timestamp: %q", value)
+	}
+
+	return parsed.UTC(), nil
+}
@@ -0,0 +1,137 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+)
+
+func TestParseRunOptions(t *testing.T) {
+	for _, c := range []struct {
+		data   string
+		expect RunOptions
+		valid  bool
+	}{
+		{"", RunOptions{}, true},
+		{"{}", RunOptions{}, true},
+		{`{"sync":"worklogs","dryRun":true}`, RunOptions{Sync: WorklogsSync, DryRun: true}, true},
+		{`{"jql":"project = ABC AND key = ABC-1"}`, RunOptions{JQL: "project = ABC AND key = ABC-1"}, true},
+		{`{"fullResync":true}`, RunOptions{FullResync: true}, true},
+		{`{"since":"2019-01-01","until":"2019-02-01"}`, RunOptions{Since: "2019-01-01", Until: "2019-02-01"}, true},
+		{`{"dry_run":true}`, RunOptions{}, false},
+		{`{"jql":"key = ABC-1","fullResync":true}`, RunOptions{}, false},
+		{`{"fullResync":true,"since":"2019-01-01"}`, RunOptions{}, false},
+		{`{"sync":"worklogs","jql":"key = ABC-1"}`, RunOptions{}, false},
+		{`{"sync":"comments","since":"2019-01-01"}`, RunOptions{}, false},
+		{`{"window":"day"}`, RunOptions{}, false},
+		{`{"jql":"key = ABC-1","cursor":"2019-11-12T10:00:00Z"}`, RunOptions{JQL: "key = ABC-1", Cursor: "2019-11-12T10:00:00Z"}, true},
+		{`{"cursor":"2019-11-12T10:00:00Z"}`, RunOptions{}, false},
+		{`{"jql":"key = ABC-1","cursor":"2019-11-12"}`, RunOptions{}, false},
+	} {
+		got, err := ParseRunOptions([]byte(c.data))
+		if (err == nil) != c.valid {
+			t.Fatalf("got invalid error for %s: %v\nexpected valid: %v", c.data, err, c.valid)
+		}
+		if c.valid && !reflect.DeepEqual(got, c.expect) {
+			t.Fatalf("got invalid options for %s: %+v\nexpected: %+v", c.data, got, c.expect)
+		}
+	}
+}
+
+func TestSnapshotModeRejectsAdhocRuns(t *testing.T) {
+	for _, c := range []struct {
+		opts  RunOptions
+		mode  string
+		valid bool
+	}{
+		{RunOptions{}, SnapshotMode, true},
+		{RunOptions{FullResync: true}, SnapshotMode, true},
+		{RunOptions{JQL: "key = ABC-1"}, SnapshotMode, false},
+		{RunOptions{Since: "2019-01-01"}, SnapshotMode, false},
+		{RunOptions{Sync: BackfillSync, Since: "2019-01-01", Until: "2019-02-01"}, SnapshotMode, false},
+		{RunOptions{JQL: "key = ABC-1"}, MergeMode, true},
+	} {
+		if err := c.opts.validateMode(c.mode); (err == nil) != c.valid {
+			t.Fatalf("got invalid error for %+v in %s mode: %v\nexpected valid: %v", c.opts, c.mode, err, c.valid)
+		}
+	}
+
+	err := InsertIssues(context.Background(), Environment{BigQueryMode: SnapshotMode}, RunOptions{JQL: "key = ABC-1"})
+	if err == nil {
+		t.Fatalf("got invalid error: %v\nexpected: %v", err, "ad-hoc run rejected in snapshot mode")
+	}
+}
+
+func TestAdhocRunKeepsCheckpoint(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/api/2/search" {
+			http.NotFound(w, r)
+			return
+		}
+		queries = append(queries, r.URL.Query().Get("jql"))
+		w.Write([]byte(`{"startAt":0,"maxResults":500,"total":1,"issues":[{"id":"1","key":"ABC-1","fields":{}}]}`))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "options")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	auth, err := json.Marshal(JiraAuth{URL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := Environment{
+		JiraAuthSecret: string(auth),
+		JiraProject:    "ABC",
+		Sink:           NDJSONSink,
+		SinkPath:       dir,
+		SchemaPath:     filepath.Join(dir, "schema.json"),
+	}
+	if err := ioutil.WriteFile(env.SchemaPath, []byte(`[{"name":"issue","type":"STRING","path":"key"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := time.Date(2019, 11, 12, 10, 0, 0, 0, time.UTC)
+	sink := &FileSink{Dir: dir, Table: "issues", Format: NDJSONSink}
+	if err := sink.RecordExecution(ctx, Execution{Timestamp: previous, Status: ExecutionSucceeded}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := InsertIssues(ctx, env, RunOptions{JQL: "key = ABC-1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if expect := []string{"key = ABC-1 ORDER BY updated ASC, key ASC"}; !reflect.DeepEqual(queries, expect) {
+		t.Fatalf("got invalid queries: %v\nexpected: %v", queries, expect)
+	}
+
+	last, err := sink.LastExecution(ctx, IssuesSync)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.Timestamp.Equal(previous) || last.Checkpoint != (bigquery.NullTimestamp{Timestamp: previous, Valid: true}) {
+		t.Fatalf("got invalid execution: %+v\nexpected: %v", last, "the ad-hoc run keeping the previous checkpoint")
+	}
+
+	checkpoint, err := ExecutionCheckpoints{Log: sink, Sync: IssuesSync}.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !checkpoint.Timestamp.Equal(previous) {
+		t.Fatalf("got invalid checkpoint: %v\nexpected: %v", checkpoint.Timestamp, previous)
+	}
+}
@@ -0,0 +1,368 @@
+package function
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+	"google.golang.org/api/iterator"
+)
+
+// StorageSink writes the rows of each run as Parquet file into Google Cloud Storage
+// Files are stored under a date partitioned prefix, e.g. `parquet/issues/dt=2019-11-12/20191112T100000.000Z-1a2b3c4d.parquet`,
+// which can be read by tools like Spark or DuckDB directly
+type StorageSink struct {
+	Bucket *storage.BucketHandle
+	Prefix string
+	Table  string
+
+	client *storage.Client
+	fields []FieldSchema
+}
+
+// NewStorageSink for the table under prefix in bucket
+func NewStorageSink(ctx context.Context, bucket, prefix, table string) (*StorageSink, error) {
+	client, err := NewStorageClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(prefix) < 1 {
+		prefix = "parquet"
+	}
+
+	return &StorageSink{Bucket: client.Bucket(bucket), Prefix: prefix, Table: table, client: client}, nil
+}
+
+// Close the storage client, if the sink created it
+func (s *StorageSink) Close() error {
+	if s.client == nil {
+		return nil
+	}
+	return s.client.Close()
+}
+
+// Prepare the sink by validating the schema can be represented in Parquet
+func (s *StorageSink) Prepare(ctx context.Context, fields []FieldSchema) error {
+	if _, err := ParquetSchema(fields); err != nil {
+		return err
+	}
+
+	s.fields = fields
+	return nil
+}
+
+// Write the rows into a new Parquet file in the partition of the current date
+// Files are never overwritten, the write fails instead if the object already exists
+func (s *StorageSink) Write(ctx context.Context, rows []Issue) (int, error) {
+	if len(rows) < 1 {
+		return 0, nil
+	}
+
+	schema, err := ParquetSchema(s.fields)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	name, err := objectName(now, "parquet")
+	if err != nil {
+		return 0, err
+	}
+	object := s.Bucket.Object(path.Join(s.Prefix, s.Table, fmt.Sprintf("dt=%s", now.Format("2006-01-02")), name))
+
+	file := &parquetObject{Writer: object.If(storage.Conditions{DoesNotExist: true}).NewWriter(ctx)}
+	file.ContentType = "application/octet-stream"
+
+	parquet, err := writer.NewJSONWriter(schema, file, 1)
+	if err != nil {
+		file.CloseWithError(err)
+		return 0, err
+	}
+
+	for _, row := range rows {
+		encoded, err := s.encode(row)
+		if err != nil {
+			file.CloseWithError(err)
+			return 0, err
+		}
+		if err := parquet.Write(encoded); err != nil {
+			file.CloseWithError(err)
+			return 0, err
+		}
+	}
+
+	if err := parquet.WriteStop(); err != nil {
+		file.CloseWithError(err)
+		return 0, err
+	}
+
+	if err := file.Close(); err != nil {
+		return 0, err
+	}
+
+	return len(rows), nil
+}
+
+// encode the row as JSON matching the Parquet schema, timestamps are converted to milliseconds
+func (s *StorageSink) encode(row Issue) (string, error) {
+	values, _, err := row.Save()
+	if err != nil {
+		return "", err
+	}
+
+	for _, field := range s.fields {
+		value, ok := values[field.Name]
+		if !ok || value == nil {
+			delete(values, field.Name)
+			continue
+		}
+
+		switch strings.ToUpper(field.Type) {
+		case "TIMESTAMP":
+			values[field.Name], err = parquetTimestamp(value)
+		case "DATE":
+			values[field.Name], err = parquetDate(value)
+		}
+		if err != nil {
+			return "", fmt.Errorf("converting %s: %v", field.Name, err)
+		}
+	}
+
+	encoded, err := json.Marshal(values)
+	return string(encoded), err
+}
+
+// Empty reports whether no Parquet file of the table has been written yet
+func (s *StorageSink) Empty(ctx context.Context) (bool, error) {
+	objects := s.Bucket.Objects(ctx, &storage.Query{Prefix: path.Join(s.Prefix, s.Table) + "/"})
+	_, err := objects.Next()
+	if err == iterator.Done {
+		return true, nil
+	}
+	return false, err
+}
+
+// objectName of a file written at t, the random suffix keeps files written within the same millisecond apart
+func objectName(t time.Time, extension string) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%x.%s", t.Format("20060102T150405.000Z"), suffix, extension), nil
+}
+
+// RecordExecution as JSON object next to the table's prefix
+func (s *StorageSink) RecordExecution(ctx context.Context, exec Execution) error {
+	writer := s.Bucket.Object(path.Join(
+		s.Prefix, s.Table+"_executions", fmt.Sprintf("%s.json", exec.Timestamp.Format("20060102T150405.000Z")),
+	)).NewWriter(ctx)
+	writer.ContentType = "application/json"
+
+	if err := json.NewEncoder(writer).Encode(exec); err != nil {
+		writer.CloseWithError(err)
+		return err
+	}
+
+	return writer.Close()
+}
+
+// LastExecution of sync that succeeded, by reading the recorded executions from newest to oldest
+func (s *StorageSink) LastExecution(ctx context.Context, sync string) (Execution, error) {
+	var names []string
+	objects := s.Bucket.Objects(ctx, &storage.Query{Prefix: path.Join(s.Prefix, s.Table+"_executions") + "/"})
+	for {
+		attrs, err := objects.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return Execution{}, err
+		}
+		names = append(names, attrs.Name)
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	for _, name := range names {
+		reader, err := s.Bucket.Object(name).NewReader(ctx)
+		if err != nil {
+			return Execution{}, err
+		}
+
+		var exec Execution
+		err = json.NewDecoder(reader).Decode(&exec)
+		reader.Close()
+		if err != nil {
+			return Execution{}, err
+		}
+
+		if exec.succeeded(sync) {
+			return exec, nil
+		}
+	}
+
+	return Execution{}, nil
+}
+
+// RecentExecutions of sync, by reading the recorded executions from newest to oldest
+func (s *StorageSink) RecentExecutions(ctx context.Context, sync string, limit int) ([]Execution, error) {
+	var names []string
+	objects := s.Bucket.Objects(ctx, &storage.Query{Prefix: path.Join(s.Prefix, s.Table+"_executions") + "/"})
+	for {
+		attrs, err := objects.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, attrs.Name)
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+
+	var executions []Execution
+	for _, name := range names {
+		if len(executions) >= limit {
+			break
+		}
+
+		reader, err := s.Bucket.Object(name).NewReader(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var exec Execution
+		err = json.NewDecoder(reader).Decode(&exec)
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if exec.of(sync) {
+			executions = append(executions, exec)
+		}
+	}
+
+	return executions, nil
+}
+
+// ParquetSchema in the JSON representation used by parquet-go, derived from the provided schema
+func ParquetSchema(from []FieldSchema) (string, error) {
+	type element struct {
+		Tag string
+	}
+
+	var fields []element
+	for _, field := range from {
+		var kind string
+		switch strings.ToUpper(field.Type) {
+		case "STRING":
+			kind = "UTF8"
+		case "BYTES":
+			kind = "BYTE_ARRAY"
+		case "INTEGER":
+			kind = "INT64"
+		case "FLOAT":
+			kind = "DOUBLE"
+		case "BOOLEAN":
+			kind = "BOOLEAN"
+		case "TIMESTAMP":
+			kind = "TIMESTAMP_MILLIS"
+		case "DATE":
+			kind = "DATE"
+		default:
+			return "", fmt.Errorf("unsupported parquet type for %s: %s", field.Name, field.Type)
+		}
+
+		repetition := "OPTIONAL"
+		if field.Repeated {
+			repetition = "REPEATED"
+		} else if field.Required {
+			repetition = "REQUIRED"
+		}
+
+		fields = append(fields, element{Tag: fmt.Sprintf("name=%s, type=%s, repetitiontype=%s", field.Name, kind, repetition)})
+	}
+
+	schema, err := json.Marshal(struct {
+		Tag    string
+		Fields []element
+	}{
+		Tag:    "name=parquet_go_root, repetitiontype=REQUIRED",
+		Fields: fields,
+	})
+
+	return string(schema), err
+}
+
+// parquetTimestamp converts a timestamp as returned by Issue.Save into milliseconds since epoch
+func parquetTimestamp(value interface{}) (interface{}, error) {
+	if values, ok := value.([]interface{}); ok {
+		return convertRepeated(values, parquetTimestamp)
+	}
+
+	t, err := time.Parse("2006-01-02 15:04:05.999999", fmt.Sprint(value))
+	if err != nil {
+		return nil, err
+	}
+
+	return t.UnixNano() / int64(time.Millisecond), nil
+}
+
+// parquetDate converts a date into days since epoch
+func parquetDate(value interface{}) (interface{}, error) {
+	if values, ok := value.([]interface{}); ok {
+		return convertRepeated(values, parquetDate)
+	}
+
+	t, err := time.Parse("2006-01-02", fmt.Sprint(value))
+	if err != nil {
+		return nil, err
+	}
+
+	return t.Unix() / int64(24*time.Hour/time.Second), nil
+}
+
+func convertRepeated(values []interface{}, convert func(interface{}) (interface{}, error)) (interface{}, error) {
+	converted := make([]interface{}, len(values))
+	for i, value := range values {
+		var err error
+		if converted[i], err = convert(value); err != nil {
+			return nil, err
+		}
+	}
+	return converted, nil
+}
+
+// parquetObject adapts a storage.Writer to the write-only parts of source.ParquetFile
+type parquetObject struct {
+	*storage.Writer
+}
+
+func (o *parquetObject) Seek(offset int64, whence int) (int64, error) {
+	return 0, errors.New("seeking is not supported by storage objects")
+}
+
+func (o *parquetObject) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (o *parquetObject) Open(name string) (source.ParquetFile, error) {
+	return nil, errors.New("opening is not supported by storage objects")
+}
+
+func (o *parquetObject) Create(name string) (source.ParquetFile, error) {
+	return nil, errors.New("creating is not supported by storage objects")
+}
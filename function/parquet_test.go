@@ -0,0 +1,230 @@
+package function
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// fakeStorage emulates the parts of the Google Cloud Storage api used by the StorageSink
+type fakeStorage struct {
+	sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/upload/storage/v1/b/"):
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		parts := multipart.NewReader(r.Body, params["boundary"])
+		var meta struct {
+			Name string `json:"name"`
+		}
+		part, _ := parts.NextPart()
+		json.NewDecoder(part).Decode(&meta)
+		part, _ = parts.NextPart()
+		if _, ok := f.objects[meta.Name]; ok && r.URL.Query().Get("ifGenerationMatch") == "0" {
+			http.Error(w, "object already exists", http.StatusPreconditionFailed)
+			return
+		}
+		f.objects[meta.Name], _ = ioutil.ReadAll(part)
+
+		json.NewEncoder(w).Encode(map[string]string{"bucket": "bucket", "name": meta.Name})
+	// like common emulators, also accept the json api without prefix, as the storage.Writer drops it
+	case r.Method == http.MethodGet && strings.TrimPrefix(r.URL.Path, "/storage/v1") == "/b/bucket/o":
+		var items []map[string]string
+		for name := range f.objects {
+			if strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+				items = append(items, map[string]string{"bucket": "bucket", "name": name})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"items": items})
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/bucket/"):
+		object, ok := f.objects[strings.TrimPrefix(r.URL.Path, "/bucket/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(object)
+	default:
+		http.Error(w, fmt.Sprintf("unexpected request: %s %s", r.Method, r.URL), http.StatusNotImplemented)
+	}
+}
+
+// parquetBuffer implements source.ParquetFile for reading written files in memory
+// Every column is read from it's own reader, so Open returns a new one
+type parquetBuffer struct {
+	*bytes.Reader
+	data []byte
+}
+
+func newParquetBuffer(data []byte) parquetBuffer {
+	return parquetBuffer{Reader: bytes.NewReader(data), data: data}
+}
+
+func (b parquetBuffer) Write(p []byte) (int, error) { return 0, nil }
+func (b parquetBuffer) Close() error                { return nil }
+func (b parquetBuffer) Open(name string) (source.ParquetFile, error) {
+	return newParquetBuffer(b.data), nil
+}
+func (b parquetBuffer) Create(name string) (source.ParquetFile, error) { return b, nil }
+
+func TestStorageSinkWritesParquetToEmulator(t *testing.T) {
+	emulator := &fakeStorage{objects: make(map[string][]byte)}
+	server := httptest.NewServer(emulator)
+	defer server.Close()
+
+	os.Setenv("STORAGE_EMULATOR_HOST", strings.TrimPrefix(server.URL, "http://"))
+	defer os.Unsetenv("STORAGE_EMULATOR_HOST")
+
+	ctx := context.Background()
+	sink, err := NewStorageSink(ctx, "bucket", "parquet", "issues")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sink.Prepare(ctx, []FieldSchema{
+		FieldSchema{Name: "issue", Type: "string", Path: "key", Required: true},
+		FieldSchema{Name: "labels", Type: "string", Path: "fields.labels", Repeated: true},
+		FieldSchema{Name: "updated", Type: "timestamp", Path: "fields.updated"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	written, err := sink.Write(ctx, []Issue{
+		Issue{"issue": "ABC-1", "labels": []interface{}{"a", "b"}, "updated": "2019-11-12T10:00:00.000+0100"},
+		Issue{"issue": "ABC-2", "labels": []interface{}{}, "updated": nil},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != 2 {
+		t.Fatalf("got invalid amount of written rows: %v", written)
+	}
+
+	if len(emulator.objects) != 1 {
+		t.Fatalf("expected a single object, got: %v", len(emulator.objects))
+	}
+
+	for name, object := range emulator.objects {
+		if !strings.HasPrefix(name, "parquet/issues/dt=") || !strings.HasSuffix(name, ".parquet") {
+			t.Fatalf("got invalid object name: %v", name)
+		}
+
+		file := newParquetBuffer(object)
+		parquet, err := reader.NewParquetReader(file, new(parquetRow), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rows := parquet.GetNumRows(); rows != 2 {
+			t.Fatalf("got invalid amount of rows in file: %v", rows)
+		}
+
+		rows := make([]parquetRow, 2)
+		if err := parquet.Read(&rows); err != nil {
+			t.Fatal(err)
+		}
+		parquet.ReadStop()
+
+		updated := time.Date(2019, 11, 12, 9, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond)
+		expect := []parquetRow{
+			parquetRow{Issue: "ABC-1", Labels: []string{"a", "b"}, Updated: &updated},
+			parquetRow{Issue: "ABC-2"},
+		}
+		if !reflect.DeepEqual(rows, expect) {
+			t.Fatalf("got invalid rows: %+v\nexpected: %+v", rows, expect)
+		}
+	}
+}
+
+// parquetRow of the files written in TestStorageSinkWritesParquetToEmulator
+type parquetRow struct {
+	Issue   string   `parquet:"name=issue, type=UTF8, repetitiontype=REQUIRED"`
+	Labels  []string `parquet:"name=labels, type=UTF8, repetitiontype=REPEATED"`
+	Updated *int64   `parquet:"name=updated, type=TIMESTAMP_MILLIS, repetitiontype=OPTIONAL"`
+}
+
+func TestStorageSinkKeepsFilesWrittenAtOnce(t *testing.T) {
+	emulator := &fakeStorage{objects: make(map[string][]byte)}
+	server := httptest.NewServer(emulator)
+	defer server.Close()
+
+	os.Setenv("STORAGE_EMULATOR_HOST", strings.TrimPrefix(server.URL, "http://"))
+	defer os.Unsetenv("STORAGE_EMULATOR_HOST")
+
+	ctx := context.Background()
+	sink, err := NewStorageSink(ctx, "bucket", "parquet", "issues")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Prepare(ctx, []FieldSchema{FieldSchema{Name: "issue", Type: "string", Path: "key"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// batches written right after each other usually share the millisecond of their object name
+	for i := 0; i < 5; i++ {
+		if _, err := sink.Write(ctx, []Issue{Issue{"issue": fmt.Sprintf("ABC-%d", i)}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(emulator.objects) != 5 {
+		t.Fatalf("got invalid amount of objects: %v\nexpected: %v", len(emulator.objects), 5)
+	}
+}
+
+func TestStorageSinkLastExecutionFromEmulator(t *testing.T) {
+	emulator := &fakeStorage{objects: make(map[string][]byte)}
+	server := httptest.NewServer(emulator)
+	defer server.Close()
+
+	os.Setenv("STORAGE_EMULATOR_HOST", strings.TrimPrefix(server.URL, "http://"))
+	defer os.Unsetenv("STORAGE_EMULATOR_HOST")
+
+	ctx := context.Background()
+	sink, err := NewStorageSink(ctx, "bucket", "parquet", "issues")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	succeeded := time.Date(2019, 11, 12, 10, 0, 0, 0, time.UTC)
+	for _, exec := range []Execution{
+		Execution{Timestamp: succeeded, Status: ExecutionSucceeded},
+		Execution{Timestamp: succeeded.Add(time.Hour), Status: ExecutionFailed},
+	} {
+		if err := sink.RecordExecution(ctx, exec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	last, err := sink.LastExecution(ctx, IssuesSync)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !last.Timestamp.Equal(succeeded) {
+		t.Fatalf("got invalid last execution: %v\nexpected: %v", last.Timestamp, succeeded)
+	}
+}
@@ -0,0 +1,178 @@
+package function
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const (
+	// HashPrivacy replaces the value by it's HMAC-SHA256, so it can still be joined and counted
+	HashPrivacy = "hash"
+	// RedactPrivacy removes the value, the column is always NULL
+	RedactPrivacy = "redact"
+	// TruncatePrivacy keeps the first Length characters of the value
+	TruncatePrivacy = "truncate"
+	// TokenizePrivacy replaces every word of the value by a short token, so texts can still be searched for known words
+	TokenizePrivacy = "tokenize"
+)
+
+// tokenLength is the amount of hex characters of a word's hash used as it's token
+const tokenLength = 12
+
+// PrivacyFilter protects the fields of extracted rows according to their Privacy option
+type PrivacyFilter struct {
+	Fields []FieldSchema
+	// Key of the HMAC used by HashPrivacy and TokenizePrivacy
+	Key []byte
+}
+
+// NewPrivacyFilter for the schema, the key is only loaded if a field gets hashed or tokenized
+func NewPrivacyFilter(ctx context.Context, env Environment, fields []FieldSchema) (PrivacyFilter, error) {
+	if err := ValidateArchive(env.Archive, fields); err != nil {
+		return PrivacyFilter{}, err
+	}
+	filter := PrivacyFilter{}
+
+	var keyed bool
+	for _, field := range fields {
+		if err := validatePrivacy(field); err != nil {
+			return PrivacyFilter{}, err
+		}
+		if len(field.Privacy) > 0 {
+			filter.Fields = append(filter.Fields, field)
+		}
+		keyed = keyed || field.Privacy == HashPrivacy || field.Privacy == TokenizePrivacy
+	}
+
+	if !keyed {
+		return filter, nil
+	}
+
+	key, err := LoadPrivacyKey(ctx, env)
+	if err != nil {
+		return PrivacyFilter{}, err
+	}
+	filter.Key = key
+
+	return filter, nil
+}
+
+// LoadPrivacyKey from the environment
+// If no KMS resource is configured, the secret is expected to contain the plain key, like for LoadJiraAuth
+func LoadPrivacyKey(ctx context.Context, env Environment) ([]byte, error) {
+	if len(env.PrivacyKeySecret) < 1 {
+		return nil, fmt.Errorf("missing environment variable: %s", "PRIVACY_KEY_SECRET")
+	}
+
+	if len(env.PrivacyKeyResource) > 0 {
+		return decrypt(ctx, env.PrivacyKeyResource, env.PrivacyKeySecret)
+	}
+
+	return []byte(env.PrivacyKeySecret), nil
+}
+
+// EncodePrivacyKey for the provided resource
+func EncodePrivacyKey(ctx context.Context, resource, key string) (string, error) {
+	return encrypt(ctx, resource, []byte(key))
+}
+
+// ValidateArchive refuses to archive the issues of a schema protecting fields, as the archive keeps their raw values
+func ValidateArchive(archive string, fields []FieldSchema) error {
+	if len(archive) < 1 {
+		return nil
+	}
+
+	for _, field := range fields {
+		if len(field.Privacy) > 0 {
+			return fmt.Errorf("invalid environment variable: %s: can not be combined with privacy %q of field %s", "ARCHIVE", field.Privacy, field.Name)
+		}
+	}
+	return nil
+}
+
+// validatePrivacy of the field, all options except RedactPrivacy produce strings and redacted fields can not be required
+func validatePrivacy(field FieldSchema) error {
+	switch field.Privacy {
+	case "":
+		return nil
+	case RedactPrivacy:
+		if field.Required {
+			return fmt.Errorf("invalid schema: %s: redacted fields can not be required", field.Name)
+		}
+		return nil
+	case HashPrivacy, TruncatePrivacy, TokenizePrivacy:
+	default:
+		return fmt.Errorf("invalid schema: %s: unknown privacy %q", field.Name, field.Privacy)
+	}
+
+	if !strings.EqualFold(field.Type, "STRING") {
+		return fmt.Errorf("invalid schema: %s: privacy %q requires type STRING", field.Name, field.Privacy)
+	}
+	if field.Privacy == TruncatePrivacy && field.Length < 1 {
+		return fmt.Errorf("invalid schema: %s: privacy %q requires a length", field.Name, field.Privacy)
+	}
+
+	return nil
+}
+
+// Apply the privacy options to the rows, which get modified in place
+func (f PrivacyFilter) Apply(rows []Issue) {
+	for _, row := range rows {
+		for _, field := range f.Fields {
+			value, ok := row[field.Name]
+			if !ok {
+				continue
+			}
+			row[field.Name] = f.protect(field, value)
+		}
+	}
+}
+
+// protect a single value of the field, the elements of repeated fields are protected individually
+// Redacted repeated fields become an empty list, as BigQuery rejects NULL for them
+func (f PrivacyFilter) protect(field FieldSchema, value interface{}) interface{} {
+	if field.Privacy == RedactPrivacy && field.Repeated {
+		return []interface{}{}
+	}
+	if field.Privacy == RedactPrivacy || value == nil {
+		return nil
+	}
+
+	if list, ok := value.([]interface{}); ok {
+		protected := make([]interface{}, len(list))
+		for i, element := range list {
+			protected[i] = f.protect(field, element)
+		}
+		return protected
+	}
+
+	text := fmt.Sprint(value)
+	switch field.Privacy {
+	case HashPrivacy:
+		return keyedHash(f.Key, text)
+	case TruncatePrivacy:
+		if runes := []rune(text); len(runes) > field.Length {
+			return string(runes[:field.Length])
+		}
+		return text
+	case TokenizePrivacy:
+		words := strings.Fields(text)
+		for i, word := range words {
+			words[i] = keyedHash(f.Key, strings.ToLower(word))[:tokenLength]
+		}
+		return strings.Join(words, " ")
+	}
+
+	return value
+}
+
+// keyedHash of the value using HMAC-SHA256, hex encoded
+func keyedHash(key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,99 @@
+package function
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestPrivacyFilter(t *testing.T) {
+	fields := []FieldSchema{
+		FieldSchema{Name: "key", Type: "STRING", Path: "key", Required: true},
+		FieldSchema{Name: "email", Type: "STRING", Path: "fields.reporter.emailAddress", Privacy: HashPrivacy},
+		FieldSchema{Name: "summary", Type: "STRING", Path: "fields.summary", Privacy: TokenizePrivacy},
+		FieldSchema{Name: "description", Type: "STRING", Path: "fields.description", Privacy: TruncatePrivacy, Length: 5},
+		FieldSchema{Name: "customer", Type: "STRING", Path: "fields.customfield_10001", Privacy: RedactPrivacy},
+		FieldSchema{Name: "labels", Type: "STRING", Path: "fields.labels", Repeated: true, Privacy: HashPrivacy},
+		FieldSchema{Name: "contacts", Type: "STRING", Path: "fields.customfield_10002", Repeated: true, Privacy: RedactPrivacy},
+	}
+
+	filter, err := NewPrivacyFilter(context.Background(), Environment{PrivacyKeySecret: "key"}, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := []Issue{Issue{
+		"key":         "ABC-1",
+		"email":       "jane@example.com",
+		"summary":     "Outage at ACME  Corp",
+		"description": "Käse is missing",
+		"customer":    "ACME Corp",
+		"labels":      []interface{}{"acme", "urgent"},
+		"contacts":    []interface{}{"jane@example.com"},
+	}}
+	filter.Apply(rows)
+
+	key := []byte("key")
+	expect := Issue{
+		"key":         "ABC-1",
+		"email":       keyedHash(key, "jane@example.com"),
+		"summary":     keyedHash(key, "outage")[:tokenLength] + " " + keyedHash(key, "at")[:tokenLength] + " " + keyedHash(key, "acme")[:tokenLength] + " " + keyedHash(key, "corp")[:tokenLength],
+		"description": "Käse ",
+		"customer":    nil,
+		"labels":      []interface{}{keyedHash(key, "acme"), keyedHash(key, "urgent")},
+		"contacts":    []interface{}{},
+	}
+	if !reflect.DeepEqual(rows[0], expect) {
+		t.Fatalf("got invalid row: %v\nexpected: %v", rows[0], expect)
+	}
+}
+
+func TestPrivacyFilterWithoutKey(t *testing.T) {
+	fields := []FieldSchema{
+		FieldSchema{Name: "customer", Type: "STRING", Path: "fields.customfield_10001", Privacy: RedactPrivacy},
+	}
+	if _, err := NewPrivacyFilter(context.Background(), Environment{}, fields); err != nil {
+		t.Fatalf("got invalid error: %v\nexpected: %v", err, nil)
+	}
+
+	fields = append(fields, FieldSchema{Name: "email", Type: "STRING", Path: "fields.reporter.emailAddress", Privacy: HashPrivacy})
+	if _, err := NewPrivacyFilter(context.Background(), Environment{}, fields); err == nil {
+		t.Fatalf("got invalid error: %v\nexpected: %v", err, "missing environment variable: PRIVACY_KEY_SECRET")
+	}
+}
+
+func TestPrivacyFilterRefusesArchive(t *testing.T) {
+	fields := []FieldSchema{
+		FieldSchema{Name: "key", Type: "STRING", Path: "key", Required: true},
+		FieldSchema{Name: "customer", Type: "STRING", Path: "fields.customfield_10001", Privacy: RedactPrivacy},
+	}
+
+	env := Environment{Archive: "file://archive"}
+	if _, err := NewPrivacyFilter(context.Background(), env, fields); err == nil {
+		t.Fatalf("got invalid error: %v\nexpected: %v", err, "invalid environment variable: ARCHIVE")
+	}
+	if _, err := NewPrivacyFilter(context.Background(), env, fields[:1]); err != nil {
+		t.Fatalf("got invalid error: %v\nexpected: %v", err, nil)
+	}
+}
+
+func TestValidatePrivacy(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		field FieldSchema
+		valid bool
+	}{
+		{"none", FieldSchema{Name: "created", Type: "TIMESTAMP"}, true},
+		{"hash", FieldSchema{Name: "email", Type: "string", Privacy: HashPrivacy}, true},
+		{"hash timestamp", FieldSchema{Name: "created", Type: "TIMESTAMP", Privacy: HashPrivacy}, false},
+		{"redact timestamp", FieldSchema{Name: "created", Type: "TIMESTAMP", Privacy: RedactPrivacy}, true},
+		{"redact repeated", FieldSchema{Name: "contacts", Type: "STRING", Repeated: true, Privacy: RedactPrivacy}, true},
+		{"redact required", FieldSchema{Name: "key", Type: "STRING", Required: true, Privacy: RedactPrivacy}, false},
+		{"truncate without length", FieldSchema{Name: "summary", Type: "STRING", Privacy: TruncatePrivacy}, false},
+		{"unknown", FieldSchema{Name: "summary", Type: "STRING", Privacy: "encrypt"}, false},
+	} {
+		if err := validatePrivacy(c.field); (err == nil) != c.valid {
+			t.Fatalf("got invalid error for %s: %v\nexpected valid: %v", c.name, err, c.valid)
+		}
+	}
+}
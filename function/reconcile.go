@@ -0,0 +1,158 @@
+package function
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/seibert-media/golibs/log"
+	"go.uber.org/zap"
+)
+
+// Reconciler is implemented by sinks able to remove issues which no longer exist in Jira
+type Reconciler interface {
+	// Keys of the issues stored in the sink, which have not been deleted yet
+	Keys(ctx context.Context) ([]string, error)
+	// Delete the issues with the provided keys and return the amount of issues deleted
+	// ErrStreamingBuffer is returned, if the rows of the issues can not be changed yet
+	Delete(ctx context.Context, keys []string, at time.Time) (int, error)
+}
+
+// Reconcile the sink with Jira by deleting all issues that were deleted or moved out of the project
+// The issues are identified by the schema field named BIGQUERY_KEY
+// In a dry run, the keys of the missing issues are printed to stdout instead and nothing gets deleted or recorded
+func Reconcile(ctx context.Context, env Environment, opts RunOptions) (err error) {
+	exec := Execution{Timestamp: time.Now().UTC(), Version: env.Version, Sync: ReconcileSync}
+
+	log.From(ctx).Debug("creating sink", zap.String("sink", env.Sink))
+	sink, err := NewSink(ctx, env)
+	if err != nil {
+		log.From(ctx).Error("creating sink", zap.Error(err))
+		return err
+	}
+	defer sink.Close()
+
+	reconciler, ok := sink.(Reconciler)
+	if !ok {
+		return fmt.Errorf("sink %T does not support reconciling", sink)
+	}
+
+	if !opts.DryRun {
+		defer recordExecution(ctx, sink, &exec, &err)
+	}
+
+	fields, err := GetSchema(ctx, env.SchemaBucket, env.SchemaPath)
+	if err != nil {
+		log.From(ctx).Error("reading schema", zap.String("bucket", env.SchemaBucket), zap.String("path", env.SchemaPath), zap.Error(err))
+		return err
+	}
+	exec.SchemaHash = SchemaHash(fields)
+
+	var key FieldSchema
+	for _, field := range fields {
+		if field.Name == env.BigQueryKey {
+			key = field
+		}
+	}
+	if len(key.Name) < 1 {
+		return fmt.Errorf("reconcile key %q is not part of the schema", env.BigQueryKey)
+	}
+
+	if !opts.DryRun {
+		if err := sink.Prepare(ctx, fields); err != nil {
+			log.From(ctx).Error("preparing sink", zap.Error(err))
+			return err
+		}
+	}
+
+	log.From(ctx).Debug("reading stored keys")
+	stored, err := reconciler.Keys(ctx)
+	if err != nil {
+		log.From(ctx).Error("reading stored keys", zap.Error(err))
+		return err
+	}
+
+	log.From(ctx).Debug("creating jira client")
+	jira, err := NewJiraClient(ctx, env)
+	if err != nil {
+		log.From(ctx).Error("creating jira client", zap.Error(err))
+		return err
+	}
+
+	exec.JQL, err = jira.Query(time.Time{})
+	if err != nil {
+		log.From(ctx).Error("building query", zap.Error(err))
+		return err
+	}
+
+	log.From(ctx).Info("fetching issue keys", zap.String("jql", exec.JQL))
+	issues, err := jira.IssueKeys(ctx, exec.JQL, keyFields(key)...)
+	if err != nil {
+		log.From(ctx).Error("fetching issue keys", zap.Error(err))
+		return err
+	}
+	exec.Fetched = len(issues)
+
+	// an empty result is far more likely to be caused by missing permissions than by an emptied project
+	if len(issues) < 1 && len(stored) > 0 {
+		return fmt.Errorf("jira returned no issues, refusing to delete all %d stored issues", len(stored))
+	}
+
+	current, err := FieldExtractor{key}.ExtractFromIssues(ctx, issues)
+	if err != nil {
+		log.From(ctx).Error("converting issues", zap.Error(err))
+		return err
+	}
+
+	missing := missingKeys(stored, current, key.Name)
+	log.From(ctx).Info("found missing issues", zap.Int("stored", len(stored)), zap.Int("current", len(current)), zap.Int("missing", len(missing)))
+
+	if opts.DryRun {
+		for _, key := range missing {
+			fmt.Fprintln(os.Stdout, key)
+		}
+		return nil
+	}
+
+	exec.Deleted, err = reconciler.Delete(ctx, missing, exec.Timestamp)
+	if err == ErrStreamingBuffer {
+		// the issues are still missing on the next run, which deletes them once their rows left the streaming buffer
+		log.From(ctx).Warn("missing issues are still in the streaming buffer, deleting them on the next run", zap.Int("missing", len(missing)))
+		return nil
+	}
+	if err != nil {
+		log.From(ctx).Error("deleting missing issues", zap.Error(err))
+		return err
+	}
+
+	log.From(ctx).Info("deleted", zap.Int("issues", exec.Deleted))
+	return nil
+}
+
+// keyFields to request from Jira to be able to extract the key field
+// Top-level attributes like id and key are always returned, fields below `fields.` need to be requested explicitly
+func keyFields(key FieldSchema) []string {
+	path := buildFieldPath(key.Path)
+	if len(path) > 1 && path[0] == "fields" {
+		return []string{"key", path[1]}
+	}
+	return nil
+}
+
+// missingKeys returns the stored keys that are not part of the current issues
+func missingKeys(stored []string, current []Issue, column string) []string {
+	existing := make(map[string]bool, len(current))
+	for _, issue := range current {
+		existing[fmt.Sprint(issue[column])] = true
+	}
+
+	var missing []string
+	for _, key := range stored {
+		if !existing[key] {
+			missing = append(missing, key)
+		}
+	}
+
+	return missing
+}
@@ -0,0 +1,35 @@
+package function
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMissingKeys(t *testing.T) {
+	stored := []string{"ABC-1", "ABC-2", "ABC-3"}
+	current := []Issue{
+		Issue{"issue": "ABC-1"},
+		Issue{"issue": "ABC-3"},
+		Issue{"issue": "ABC-4"},
+	}
+
+	got := missingKeys(stored, current, "issue")
+	expect := []string{"ABC-2"}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got invalid missing keys: %v\nexpected: %v", got, expect)
+	}
+}
+
+func TestKeyFields(t *testing.T) {
+	for path, expect := range map[string][]string{
+		"key":              nil,
+		"id":               nil,
+		"fields.customId":  []string{"key", "customId"},
+		"fields.epic.name": []string{"key", "epic"},
+	} {
+		got := keyFields(FieldSchema{Name: "key", Path: path})
+		if !reflect.DeepEqual(got, expect) {
+			t.Fatalf("got invalid fields for %s: %v\nexpected: %v", path, got, expect)
+		}
+	}
+}
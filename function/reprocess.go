@@ -0,0 +1,184 @@
+package function
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/seibert-media/golibs/log"
+	"go.uber.org/zap"
+)
+
+// reprocessBatch is the amount of archived issues written at once, so the archive never has to fit into memory
+const reprocessBatch = 500
+
+// Reprocess the issues stored in the archive with the current schema and write them into the sink, without querying Jira
+// In append mode all archived versions of an issue are written, which requires an empty table, as it would contain them twice otherwise
+// In merge mode only the latest version is written, snapshots are not supported as they can not be written in batches
+// The run does not advance the checkpoint of the issues sync, as the archive may be older than the last run
+// A run reaching it's deadline continues after the last written version in a follow-up run, it saves that position
+// as checkpoint of the reprocess sync, so a run started without after resumes from it once the follow-up run got lost
+// In a dry run, the rows are printed to stdout instead and nothing gets created, written or recorded
+func Reprocess(ctx context.Context, env Environment, opts RunOptions) (err error) {
+	if len(env.Archive) < 1 {
+		err := fmt.Errorf("missing environment variable: %s", "ARCHIVE")
+		log.From(ctx).Error("reprocessing", zap.Error(err))
+		return err
+	}
+	if env.BigQueryMode == SnapshotMode {
+		err := fmt.Errorf("reprocessing is not supported in %s mode, as a snapshot has to be written at once", SnapshotMode)
+		log.From(ctx).Error("reprocessing", zap.Error(err))
+		return err
+	}
+
+	exec := Execution{Timestamp: time.Now().UTC(), Version: env.Version, Sync: ReprocessSync}
+
+	sink, checkpoints, err := openSink(ctx, env, opts, ReprocessSync)
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+	defer checkpoints.Close()
+	defer recordExecution(ctx, sink, &exec, &err)
+
+	fields, err := GetSchema(ctx, env.SchemaBucket, env.SchemaPath)
+	if err != nil {
+		log.From(ctx).Error("reading schema", zap.String("bucket", env.SchemaBucket), zap.String("path", env.SchemaPath), zap.Error(err))
+		return err
+	}
+	exec.SchemaHash = SchemaHash(fields)
+
+	privacy, err := NewPrivacyFilter(ctx, env, fields)
+	if err != nil {
+		log.From(ctx).Error("loading privacy", zap.Error(err))
+		return err
+	}
+
+	if err := sink.Prepare(ctx, fields); err != nil {
+		log.From(ctx).Error("preparing sink", zap.Error(err))
+		return err
+	}
+
+	after := opts.After
+	if len(after) < 1 {
+		log.From(ctx).Debug("loading checkpoint")
+		last, err := checkpoints.Load(ctx)
+		if err != nil {
+			log.From(ctx).Error("loading checkpoint", zap.Error(err))
+			return err
+		}
+		// only a run stopped early leaves a position, completed runs start over
+		if len(last.Position) > 0 {
+			log.From(ctx).Info("resuming reprocess", zap.String("after", last.Position))
+			after = last.Position
+		}
+	}
+
+	// a continuation appends to the rows written by the runs before it
+	latest := env.BigQueryMode == MergeMode
+	if !latest && !opts.DryRun && len(after) < 1 {
+		if err := requireEmpty(ctx, sink); err != nil {
+			log.From(ctx).Error("checking table", zap.Error(err))
+			return err
+		}
+	}
+
+	archive, err := NewArchive(ctx, env)
+	if err != nil {
+		log.From(ctx).Error("creating archive", zap.Error(err))
+		return err
+	}
+	defer archive.Close()
+
+	deadline := runDeadline(ctx, env, opts, exec.Timestamp)
+
+	// the version of the current issue is only added to the batch, once it is known to be the latest one
+	var batch []Issue
+	var pending Issue
+	var pendingName, written string
+	write := func() error {
+		if len(batch) < 1 {
+			return nil
+		}
+		exec.Fetched += len(batch)
+		if err := writeIssues(ctx, env, opts, sink, fields, privacy, batch, &exec); err != nil {
+			return err
+		}
+		batch = nil
+		return nil
+	}
+
+	log.From(ctx).Info("reading archive", zap.String("archive", env.Archive), zap.String("after", after))
+	err = archive.Issues(ctx, after, func(name string, issue Issue) error {
+		if latest && sameIssue(pending, issue) {
+			pending, pendingName = issue, name
+			return nil
+		}
+		if pending != nil {
+			batch = append(batch, pending)
+			written = pendingName
+		}
+		pending, pendingName = issue, name
+
+		if len(batch) < reprocessBatch {
+			return nil
+		}
+		if err := write(); err != nil {
+			return err
+		}
+		if deadlineReached(ctx, deadline) {
+			return ErrDeadline
+		}
+		return nil
+	})
+	truncated := err == ErrDeadline
+	if err != nil && !truncated {
+		log.From(ctx).Error("reading archive", zap.Error(err))
+		return err
+	}
+
+	next := Checkpoint{Timestamp: exec.Timestamp}
+	if truncated {
+		exec.Position, next.Position = written, written
+	} else {
+		if pending != nil {
+			batch = append(batch, pending)
+		}
+		if err := write(); err != nil {
+			return err
+		}
+	}
+
+	log.From(ctx).Debug("saving checkpoint")
+	if err := checkpoints.Save(ctx, next); err != nil {
+		log.From(ctx).Error("saving checkpoint", zap.Error(err))
+		return err
+	}
+
+	if truncated {
+		if err := Continue(ctx, env, RunOptions{Sync: ReprocessSync, After: written}); err != nil {
+			return err
+		}
+	}
+
+	log.From(ctx).Info("reprocessed", zap.Int("issues", exec.Inserted))
+	return nil
+}
+
+// requireEmpty fails unless the sink's table is known to contain no rows
+func requireEmpty(ctx context.Context, sink Sink) error {
+	inspector, ok := sink.(TableInspector)
+	if !ok {
+		return fmt.Errorf("reprocessing in %s mode requires an empty table, which the sink can not check", AppendMode)
+	}
+
+	empty, err := inspector.Empty(ctx)
+	if err != nil {
+		return err
+	}
+	if !empty {
+		return fmt.Errorf("reprocessing in %s mode requires an empty table, as it writes all archived versions again", AppendMode)
+	}
+
+	return nil
+}
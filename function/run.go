@@ -0,0 +1,125 @@
+package function
+
+import (
+	"context"
+	"os"
+
+	"github.com/seibert-media/golibs/log"
+	"go.uber.org/zap"
+)
+
+// Run the sync selected by opts
+// The metrics are pushed afterwards, if the environment has a Pushgateway
+func Run(ctx context.Context, env Environment, opts RunOptions) (err error) {
+	defer pushMetrics(ctx, env, opts)
+
+	// the salt is decrypted once, so the syncs can hash users without calling KMS for every batch
+	if env.UserSalt, err = LoadUserSalt(ctx, env); err != nil {
+		log.From(ctx).Error("loading user salt", zap.Error(err))
+		return err
+	}
+	env.UserSaltResource = ""
+
+	switch opts.Sync {
+	case ReconcileSync:
+		return Reconcile(ctx, env, opts)
+	case WorklogsSync:
+		return SyncWorklogs(ctx, env, opts)
+	case CommentsSync:
+		return SyncComments(ctx, env, opts)
+	case AgileSync:
+		return SyncAgile(ctx, env, opts)
+	case MetadataSync:
+		return SyncMetadata(ctx, env, opts)
+	case BackfillSync:
+		return Backfill(ctx, env, opts)
+	case ReprocessSync:
+		return Reprocess(ctx, env, opts)
+	}
+	return InsertIssues(ctx, env, opts)
+}
+
+// openSink and the checkpoint store for a run of sync, both have to be closed by the caller
+// In a dry run, the sink prints the rows to stdout instead and the checkpoints are never saved
+func openSink(ctx context.Context, env Environment, opts RunOptions, sync string) (Sink, CheckpointStore, error) {
+	log.From(ctx).Debug("creating sink", zap.String("sink", env.Sink))
+	sink, err := NewSink(ctx, env)
+	if err != nil {
+		log.From(ctx).Error("creating sink", zap.Error(err))
+		return nil, nil, err
+	}
+
+	checkpoints, err := NewCheckpointStore(ctx, env, sink, sync)
+	if err != nil {
+		log.From(ctx).Error("creating checkpoint store", zap.Error(err))
+		sink.Close()
+		return nil, nil, err
+	}
+
+	if opts.DryRun {
+		log.From(ctx).Info("dry run, printing rows instead of writing them")
+		sink = &DryRunSink{Out: os.Stdout, Format: opts.Format, Table: env.tableName(), Mode: env.BigQueryMode, source: sink}
+		checkpoints = readOnlyCheckpoints{checkpoints}
+	}
+
+	return sink, checkpoints, nil
+}
+
+// openTable sink for syncs writing into multiple tables, in a dry run the sink prints the rows to stdout instead
+// The sink has to be closed by the caller
+func openTable(ctx context.Context, env Environment, opts RunOptions) (Sink, error) {
+	if opts.DryRun {
+		return &DryRunSink{Out: os.Stdout, Format: opts.Format, Table: env.tableName(), Mode: env.BigQueryMode}, nil
+	}
+
+	log.From(ctx).Debug("creating sink", zap.String("sink", env.Sink), zap.String("table", env.tableName()))
+	sink, err := NewSink(ctx, env)
+	if err != nil {
+		log.From(ctx).Error("creating sink", zap.Error(err))
+		return nil, err
+	}
+
+	return sink, nil
+}
+
+// recordExecution finishes exec with the run's error and records it in the sink
+// Meant to be deferred, so a failed recording is returned in place of a successful run's nil error
+func recordExecution(ctx context.Context, sink Sink, exec *Execution, err *error) {
+	exec.Finish(*err)
+	collectExecution(ctx, *exec)
+	observeExecution(*exec)
+	if recordErr := sink.RecordExecution(ctx, *exec); recordErr != nil {
+		log.From(ctx).Error("recording execution", zap.Error(recordErr))
+		if *err == nil {
+			*err = recordErr
+		}
+	}
+}
+
+// openRecorder for syncs writing into other tables, which record their runs in the executions of the issues table
+// The sink gets prepared, so the executions table is up to date before the run gets recorded, and has to be closed by the caller
+func openRecorder(ctx context.Context, env Environment, opts RunOptions, sync string) (Sink, error) {
+	sink, checkpoints, err := openSink(ctx, env, opts, sync)
+	if err != nil {
+		return nil, err
+	}
+	checkpoints.Close()
+	if opts.DryRun {
+		return sink, nil
+	}
+
+	fields, err := GetSchema(ctx, env.SchemaBucket, env.SchemaPath)
+	if err != nil {
+		log.From(ctx).Error("reading schema", zap.String("bucket", env.SchemaBucket), zap.String("path", env.SchemaPath), zap.Error(err))
+		sink.Close()
+		return nil, err
+	}
+
+	if err := sink.Prepare(ctx, fields); err != nil {
+		log.From(ctx).Error("preparing sink", zap.Error(err))
+		sink.Close()
+		return nil, err
+	}
+
+	return sink, nil
+}
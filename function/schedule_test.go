@@ -0,0 +1,44 @@
+package function
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// 2019-11-12 is a tuesday
+	now := time.Date(2019, 11, 12, 10, 7, 30, 0, time.UTC)
+	for _, c := range []struct {
+		spec   string
+		expect time.Time
+	}{
+		{"* * * * *", time.Date(2019, 11, 12, 10, 8, 0, 0, time.UTC)},
+		{"0 0 * * *", time.Date(2019, 11, 13, 0, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2019, 11, 12, 10, 15, 0, 0, time.UTC)},
+		{"5/20 9-11 * * *", time.Date(2019, 11, 12, 10, 25, 0, 0, time.UTC)},
+		{"0 3 * * 0", time.Date(2019, 11, 17, 3, 0, 0, 0, time.UTC)},
+		{"0 3 * * 7", time.Date(2019, 11, 17, 3, 0, 0, 0, time.UTC)},
+		{"30 8 1,15 * *", time.Date(2019, 11, 15, 8, 30, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// either restricted day field matches
+		{"0 0 1 * 5", time.Date(2019, 11, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	} {
+		schedule, err := ParseSchedule(c.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := schedule.Next(now); !got.Equal(c.expect) {
+			t.Fatalf("got invalid next time of %q: %v\nexpected: %v", c.spec, got, c.expect)
+		}
+	}
+}
+
+func TestParseScheduleRejectsInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@daily"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Fatalf("got invalid error for %q: %v\nexpected: %v", spec, err, "an error")
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package function
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"strings"
 
 	"cloud.google.com/go/bigquery"
@@ -13,6 +17,10 @@ type FieldSchema struct {
 	Path     string `json:"path,omitempty"`
 	Required bool   `json:"required,omitempty"`
 	Repeated bool   `json:"repeated,omitempty"`
+	// Privacy protects the field's values before they are written, either HashPrivacy, RedactPrivacy, TruncatePrivacy or TokenizePrivacy
+	Privacy string `json:"privacy,omitempty"`
+	// Length is the amount of characters kept by TruncatePrivacy
+	Length int `json:"length,omitempty"`
 }
 
 // BigQuerySchema from the provided schema
@@ -30,3 +38,51 @@ func BigQuerySchema(from []FieldSchema) bigquery.Schema {
 
 	return bigquery.Schema(fieldSchemas)
 }
+
+// SchemaHash identifies the provided schema, so rows can be related to the schema version that produced them
+func SchemaHash(from []FieldSchema) string {
+	encoded, err := json.Marshal(from)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// BigQueryDDL to create a table with the provided schema in the BigQueryMode
+// In SnapshotMode the table contains and is partitioned by the snapshotColumn
+func BigQueryDDL(table string, from []FieldSchema, mode string) string {
+	schema := BigQuerySchema(from)
+	if mode == SnapshotMode {
+		schema = append(schema, &bigquery.FieldSchema{Name: snapshotColumn, Required: true, Type: bigquery.DateFieldType})
+	}
+
+	var columns []string
+	for _, field := range schema {
+		kind := string(field.Type)
+		if field.Type == bigquery.IntegerFieldType {
+			kind = "INT64"
+		}
+		if field.Type == bigquery.FloatFieldType {
+			kind = "FLOAT64"
+		}
+		if field.Type == bigquery.BooleanFieldType {
+			kind = "BOOL"
+		}
+		if field.Repeated {
+			kind = fmt.Sprintf("ARRAY<%s>", kind)
+		}
+		if field.Required {
+			kind += " NOT NULL"
+		}
+		columns = append(columns, fmt.Sprintf("  `%s` %s", field.Name, kind))
+	}
+
+	ddl := fmt.Sprintf("CREATE TABLE `%s` (\n%s\n)", table, strings.Join(columns, ",\n"))
+	if mode == SnapshotMode {
+		ddl += fmt.Sprintf("\nPARTITION BY `%s`", snapshotColumn)
+	}
+
+	return ddl
+}
@@ -0,0 +1,459 @@
+package function
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	// BigQuerySink writes to BigQuery, this is the default
+	BigQuerySink = "bigquery"
+	// NDJSONSink writes newline-delimited JSON files
+	NDJSONSink = "ndjson"
+	// CSVSink writes CSV files
+	CSVSink = "csv"
+	// SQLSink writes to a SQL database using database/sql
+	SQLSink = "sql"
+	// ParquetSink writes Parquet files to the schema bucket
+	ParquetSink = "parquet"
+)
+
+// Sink receives the rows extracted by a run
+type Sink interface {
+	// Prepare the sink for rows of the provided schema, e.g. by creating tables
+	Prepare(ctx context.Context, fields []FieldSchema) error
+	// Write a batch of rows and return the amount of rows written
+	Write(ctx context.Context, rows []Issue) (int, error)
+	// RecordExecution of a run
+	RecordExecution(ctx context.Context, exec Execution) error
+	// Close the sink and the clients it holds
+	Close() error
+}
+
+// ExecutionLog is implemented by sinks able to look up their recorded executions
+type ExecutionLog interface {
+	// LastExecution of sync that succeeded, or an empty Execution if there is none
+	LastExecution(ctx context.Context, sync string) (Execution, error)
+}
+
+// ExecutionHistory is implemented by sinks able to list their recorded executions
+type ExecutionHistory interface {
+	// RecentExecutions of sync including failed ones, newest first and at most limit
+	// Only the timestamp, status and row counts of the executions are returned
+	RecentExecutions(ctx context.Context, sync string, limit int) ([]Execution, error)
+}
+
+// TableInspector is implemented by sinks able to tell whether their table contains rows
+type TableInspector interface {
+	// Empty reports whether the table contains no rows, which includes a table that does not exist yet
+	Empty(ctx context.Context) (bool, error)
+}
+
+// NewSink selected by the environment
+func NewSink(ctx context.Context, env Environment) (Sink, error) {
+	table := env.tableName()
+
+	switch env.Sink {
+	case "", BigQuerySink:
+		return NewBigQueryClient(ctx, env)
+	case NDJSONSink, CSVSink:
+		return &FileSink{Dir: env.SinkPath, Table: table, Format: env.Sink, Mode: env.BigQueryMode, Key: env.BigQueryKey}, nil
+	case SQLSink:
+		sink, err := NewDatabaseSink(env.SinkDriver, env.SinkPath, table)
+		if err != nil {
+			return nil, err
+		}
+		sink.Mode, sink.Key = env.BigQueryMode, env.BigQueryKey
+		return sink, nil
+	case ParquetSink:
+		if env.BigQueryMode == MergeMode {
+			return nil, fmt.Errorf("the %s sink does not support %s mode, which the table %s requires", ParquetSink, MergeMode, table)
+		}
+		return NewStorageSink(ctx, env.SchemaBucket, env.SinkPath, table)
+	}
+
+	return nil, fmt.Errorf("unknown sink: %s", env.Sink)
+}
+
+// tableName the selected sink writes to, for BigQuery this is the fully qualified name
+func (e Environment) tableName() string {
+	switch {
+	case len(e.Sink) < 1 || e.Sink == BigQuerySink:
+		return fmt.Sprintf("%s.%s.%s", e.BigQueryProject, e.BigQueryDataset, e.BigQueryTable)
+	case len(e.SinkTable) > 0:
+		return e.SinkTable
+	}
+	return "issues"
+}
+
+// dimension environment for syncs writing into the table named `<table>_<suffix>`, whose rows are identified by key
+// Dimension tables always use the MergeMode, so rows written by an earlier run are replaced instead of being appended again
+// All sinks except the ParquetSink support it, which refuses to write dimension tables
+func (e Environment) dimension(suffix, key string) Environment {
+	if len(e.SinkTable) < 1 {
+		e.SinkTable = "issues"
+	}
+	e.SinkTable = fmt.Sprintf("%s_%s", e.SinkTable, suffix)
+	e.BigQueryTable = fmt.Sprintf("%s_%s", e.BigQueryTable, suffix)
+	e.BigQueryKey = key
+	e.BigQueryMode = MergeMode
+	e.BigQueryHistory = false
+	return e
+}
+
+// Write implements Sink by inserting into the client's table
+func (c *BigQueryClient) Write(ctx context.Context, rows []Issue) (int, error) {
+	return c.Insert(ctx, rows)
+}
+
+// FileSink writes rows into local files, one file per table inside Dir
+// Executions are always recorded as newline-delimited JSON, independent of the Format
+type FileSink struct {
+	Dir    string
+	Table  string
+	Format string
+	// Mode the rows are written in, in MergeMode the file is rewritten without the rows with the same value in the Key column
+	Mode string
+	Key  string
+
+	fields []FieldSchema
+}
+
+// Prepare the sink by creating it's directory
+func (s *FileSink) Prepare(ctx context.Context, fields []FieldSchema) error {
+	if s.Mode == MergeMode && !hasField(fields, s.Key) {
+		return fmt.Errorf("merge key %q is not part of the schema", s.Key)
+	}
+	s.fields = fields
+	return os.MkdirAll(s.Dir, 0755)
+}
+
+// Write the rows by appending them to the table's file
+func (s *FileSink) Write(ctx context.Context, rows []Issue) (int, error) {
+	if s.Mode == MergeMode {
+		return s.merge(rows)
+	}
+
+	file, err := os.OpenFile(s.path(s.Table, s.Format), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	return s.write(file, rows)
+}
+
+func (s *FileSink) write(file *os.File, rows []Issue) (int, error) {
+	if s.Format == CSVSink {
+		return s.writeCSV(file, rows)
+	}
+
+	return s.writeNDJSON(file, rows)
+}
+
+// merge the rows into the table's file, by rewriting it without the rows of the same keys followed by the rows
+func (s *FileSink) merge(rows []Issue) (int, error) {
+	keys := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		values, _, err := row.Save()
+		if err != nil {
+			return 0, err
+		}
+		key, err := formatValue(values[s.Key])
+		if err != nil {
+			return 0, err
+		}
+		keys[key] = true
+	}
+
+	path := s.path(s.Table, s.Format)
+	file, err := ioutil.TempFile(s.Dir, filepath.Base(path))
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+	if err := file.Chmod(0644); err != nil {
+		return 0, err
+	}
+
+	if err := s.copyUnless(file, path, keys); err != nil {
+		return 0, err
+	}
+
+	written, err := s.write(file, rows)
+	if err != nil {
+		return written, err
+	}
+	if err := file.Close(); err != nil {
+		return 0, err
+	}
+
+	return written, os.Rename(file.Name(), path)
+}
+
+// copyUnless copies the rows of the file at path to dst, except the ones with a key contained in keys
+// The header of a CSV file is always copied
+func (s *FileSink) copyUnless(dst *os.File, path string, keys map[string]bool) error {
+	src, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if s.Format == CSVSink {
+		return s.copyCSV(dst, src, keys)
+	}
+
+	writer := bufio.NewWriter(dst)
+	reader := bufio.NewReader(src)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			decoder := json.NewDecoder(bytes.NewReader(line))
+			decoder.UseNumber()
+			var values map[string]interface{}
+			if err := decoder.Decode(&values); err != nil {
+				return err
+			}
+			key, err := formatValue(values[s.Key])
+			if err != nil {
+				return err
+			}
+			if !keys[key] {
+				if _, err := writer.Write(line); err != nil {
+					return err
+				}
+			}
+		}
+		if err == io.EOF {
+			return writer.Flush()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *FileSink) copyCSV(dst, src *os.File, keys map[string]bool) error {
+	records, err := csv.NewReader(src).ReadAll()
+	if err != nil || len(records) < 1 {
+		return err
+	}
+
+	column := -1
+	for i, name := range records[0] {
+		if name == s.Key {
+			column = i
+		}
+	}
+	if column < 0 {
+		return fmt.Errorf("merge key %q is not part of the header of %s", s.Key, src.Name())
+	}
+
+	writer := csv.NewWriter(dst)
+	for i, record := range records {
+		if i > 0 && keys[record[column]] {
+			continue
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func (s *FileSink) writeNDJSON(file *os.File, rows []Issue) (int, error) {
+	encoder := json.NewEncoder(file)
+	for i, row := range rows {
+		values, _, err := row.Save()
+		if err != nil {
+			return i, err
+		}
+		if err := encoder.Encode(values); err != nil {
+			return i, err
+		}
+	}
+
+	return len(rows), nil
+}
+
+func (s *FileSink) writeCSV(file *os.File, rows []Issue) (int, error) {
+	writer := csv.NewWriter(file)
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() == 0 {
+		var header []string
+		for _, field := range s.fields {
+			header = append(header, field.Name)
+		}
+		if err := writer.Write(header); err != nil {
+			return 0, err
+		}
+	}
+
+	for i, row := range rows {
+		values, _, err := row.Save()
+		if err != nil {
+			return i, err
+		}
+
+		record := make([]string, len(s.fields))
+		for j, field := range s.fields {
+			if record[j], err = formatValue(values[field.Name]); err != nil {
+				return i, err
+			}
+		}
+
+		if err := writer.Write(record); err != nil {
+			return i, err
+		}
+	}
+
+	writer.Flush()
+	return len(rows), writer.Error()
+}
+
+// Empty reports whether the table's file contains no rows
+func (s *FileSink) Empty(ctx context.Context) (bool, error) {
+	info, err := os.Stat(s.path(s.Table, s.Format))
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// the header of a CSV file is written together with the first rows
+	return info.Size() == 0, nil
+}
+
+// RecordExecution by appending it to the table's executions file
+func (s *FileSink) RecordExecution(ctx context.Context, exec Execution) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.path(s.Table+"_executions", NDJSONSink), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return json.NewEncoder(file).Encode(exec)
+}
+
+// LastExecution of sync that succeeded from the table's executions file
+func (s *FileSink) LastExecution(ctx context.Context, sync string) (Execution, error) {
+	file, err := os.Open(s.path(s.Table+"_executions", NDJSONSink))
+	if os.IsNotExist(err) {
+		return Execution{}, nil
+	}
+	if err != nil {
+		return Execution{}, err
+	}
+	defer file.Close()
+
+	var last Execution
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var exec Execution
+		if err := json.Unmarshal(scanner.Bytes(), &exec); err != nil {
+			return Execution{}, err
+		}
+		if exec.succeeded(sync) && exec.Timestamp.After(last.Timestamp) {
+			last = exec
+		}
+	}
+
+	return last, scanner.Err()
+}
+
+// RecentExecutions of sync from the table's executions file
+func (s *FileSink) RecentExecutions(ctx context.Context, sync string, limit int) ([]Execution, error) {
+	file, err := os.Open(s.path(s.Table+"_executions", NDJSONSink))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var executions []Execution
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var exec Execution
+		if err := json.Unmarshal(scanner.Bytes(), &exec); err != nil {
+			return nil, err
+		}
+		if exec.of(sync) {
+			executions = append(executions, exec)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(executions, func(i, j int) bool { return executions[i].Timestamp.After(executions[j].Timestamp) })
+	if len(executions) > limit {
+		executions = executions[:limit]
+	}
+
+	return executions, nil
+}
+
+// Close is a no-op, as files are only opened while writing
+func (s *FileSink) Close() error {
+	return nil
+}
+
+// path of the file storing table in the provided format
+func (s *FileSink) path(table, format string) string {
+	return filepath.Join(s.Dir, fmt.Sprintf("%s.%s", table, format))
+}
+
+// uniqueRows keeps the last of the rows with the same value in the column key, as rows merged into a table must be unique
+func uniqueRows(rows []Issue, key string) []Issue {
+	index := make(map[interface{}]int, len(rows))
+	var unique []Issue
+	for _, row := range rows {
+		if i, ok := index[row[key]]; ok {
+			unique[i] = row
+			continue
+		}
+		index[row[key]] = len(unique)
+		unique = append(unique, row)
+	}
+	return unique
+}
+
+// formatValue as string, encoding everything except strings as JSON
+func formatValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+
+	encoded, err := json.Marshal(value)
+	return string(encoded), err
+}
@@ -0,0 +1,144 @@
+package function
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSinkWritesCSVWithHeader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	sink := &FileSink{Dir: dir, Table: "issues", Format: CSVSink}
+
+	if err := sink.Prepare(ctx, []FieldSchema{
+		FieldSchema{Name: "issue", Type: "string", Path: "key"},
+		FieldSchema{Name: "labels", Type: "string", Path: "fields.labels", Repeated: true},
+		FieldSchema{Name: "updated", Type: "timestamp", Path: "fields.updated"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, issue := range []Issue{
+		Issue{"issue": "ABC-1", "labels": []interface{}{"a", "b"}, "updated": "2019-11-12T10:00:00.000+0100"},
+		Issue{"issue": "ABC-2", "labels": []interface{}{}},
+	} {
+		if _, err := sink.Write(ctx, []Issue{issue}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := ioutil.ReadFile(filepath.Join(dir, "issues.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := "issue,labels,updated\nABC-1,\"[\"\"a\"\",\"\"b\"\"]\",2019-11-12 09:00:00\nABC-2,[],\n"
+	if string(got) != expect {
+		t.Fatalf("got invalid csv: %v\nexpected: %v", string(got), expect)
+	}
+}
+
+func TestFileSinkMergesRowsByKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	for _, c := range []struct {
+		format string
+		expect string
+	}{
+		{CSVSink, "id,name\n2,b\n1,c\n"},
+		{NDJSONSink, "{\"id\":2,\"name\":\"b\"}\n{\"id\":1,\"name\":\"c\"}\n"},
+	} {
+		sink := &FileSink{Dir: dir, Table: "boards", Format: c.format, Mode: MergeMode, Key: "id"}
+		if err := sink.Prepare(ctx, []FieldSchema{
+			FieldSchema{Name: "id", Type: "integer", Path: "id"},
+			FieldSchema{Name: "name", Type: "string", Path: "name"},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, rows := range [][]Issue{
+			[]Issue{Issue{"id": 1, "name": "a"}, Issue{"id": 2, "name": "b"}},
+			[]Issue{Issue{"id": 1, "name": "c"}},
+		} {
+			if _, err := sink.Write(ctx, rows); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got, err := ioutil.ReadFile(filepath.Join(dir, "boards."+c.format))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != c.expect {
+			t.Fatalf("got invalid %s: %v\nexpected: %v", c.format, string(got), c.expect)
+		}
+	}
+}
+
+func TestFileSinkLastExecutionIgnoresFailedAndOtherRuns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	sink := &FileSink{Dir: dir, Table: "issues", Format: NDJSONSink}
+
+	last, err := sink.LastExecution(ctx, IssuesSync)
+	if err != nil {
+		t.Fatal("reading missing executions", err)
+	}
+	if !last.Timestamp.IsZero() {
+		t.Fatalf("got non-empty initial execution: %v", last)
+	}
+
+	succeeded := time.Date(2019, 11, 12, 10, 0, 0, 0, time.UTC)
+	for _, exec := range []Execution{
+		Execution{Timestamp: succeeded, Status: ExecutionSucceeded},
+		Execution{Timestamp: succeeded.Add(time.Hour), Status: ExecutionFailed},
+		Execution{Timestamp: succeeded.Add(2 * time.Hour), Status: ExecutionSucceeded, Sync: ReconcileSync},
+	} {
+		if err := sink.RecordExecution(ctx, exec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	last, err = sink.LastExecution(ctx, IssuesSync)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !last.Timestamp.Equal(succeeded) {
+		t.Fatalf("got invalid last execution: %v\nexpected: %v", last.Timestamp, succeeded)
+	}
+}
+
+func TestDimensionMergesUniqueRows(t *testing.T) {
+	env := Environment{BigQueryTable: "issues", BigQueryMode: AppendMode, BigQueryHistory: true}.dimension("links", "id")
+	if env.BigQueryTable != "issues_links" || env.SinkTable != "issues_links" || env.BigQueryMode != MergeMode || env.BigQueryHistory {
+		t.Fatalf("got invalid environment: %+v\nexpected: %v", env, "the links table in merge mode")
+	}
+
+	rows := uniqueRows([]Issue{
+		Issue{"id": "1", "body": "first"},
+		Issue{"id": "2", "body": "other"},
+		Issue{"id": "1", "body": "edited"},
+	}, "id")
+	if len(rows) != 2 || rows[0]["body"] != "edited" || rows[1]["id"] != "2" {
+		t.Fatalf("got invalid rows: %v\nexpected: %v", rows, "the last version of each row")
+	}
+}
@@ -0,0 +1,477 @@
+package function
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	// register the postgres driver, other drivers like sqlite3 have to be registered by the binary importing the package
+	_ "github.com/lib/pq"
+)
+
+// DatabaseSink writes rows into a table of a SQL database
+// Repeated fields and lists or objects are stored as JSON encoded text
+type DatabaseSink struct {
+	DB     *sql.DB
+	Driver string
+	Table  string
+	// Mode the rows are written in, in MergeMode rows replace the rows with the same value in the Key column
+	Mode string
+	Key  string
+
+	fields []FieldSchema
+}
+
+// NewDatabaseSink for the database reachable with driver and dsn
+// The driver defaults to postgres
+func NewDatabaseSink(driver, dsn, table string) (*DatabaseSink, error) {
+	if len(driver) < 1 {
+		driver = "postgres"
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DatabaseSink{DB: db, Driver: driver, Table: table}, nil
+}
+
+// Prepare the sink by creating the table and it's executions table, if they do not exist
+func (s *DatabaseSink) Prepare(ctx context.Context, fields []FieldSchema) error {
+	if s.Mode == MergeMode && !hasField(fields, s.Key) {
+		return fmt.Errorf("merge key %q is not part of the schema", s.Key)
+	}
+	s.fields = fields
+
+	var columns []string
+	for _, field := range fields {
+		column := fmt.Sprintf("%s %s", s.quote(field.Name), sqlType(field))
+		if field.Required {
+			column += " NOT NULL"
+		}
+		columns = append(columns, column)
+	}
+
+	if _, err := s.DB.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (%s)", s.quote(s.Table), strings.Join(columns, ", "),
+	)); err != nil {
+		return err
+	}
+
+	columns = nil
+	for _, field := range executionSchema {
+		columns = append(columns, fmt.Sprintf("%s %s", s.quote(field.Name), sqlType(FieldSchema{Type: string(field.Type)})))
+	}
+
+	if _, err := s.DB.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (%s)", s.quote(s.Table+"_executions"), strings.Join(columns, ", "),
+	)); err != nil {
+		return err
+	}
+
+	return s.addMissingExecutionColumns(ctx)
+}
+
+// addMissingExecutionColumns to an executions table created by an earlier version
+func (s *DatabaseSink) addMissingExecutionColumns(ctx context.Context) error {
+	known, err := s.columns(ctx, s.Table+"_executions")
+	if err != nil {
+		return err
+	}
+
+	for _, field := range executionSchema {
+		if known[field.Name] {
+			continue
+		}
+		if _, err := s.DB.ExecContext(ctx, fmt.Sprintf(
+			"ALTER TABLE %s ADD COLUMN %s %s",
+			s.quote(s.Table+"_executions"), s.quote(field.Name), sqlType(FieldSchema{Type: string(field.Type)}),
+		)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// columns of table, lowercased
+func (s *DatabaseSink) columns(ctx context.Context, table string) (map[string]bool, error) {
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s WHERE 1 = 0", s.quote(table)))
+	if err != nil {
+		return nil, err
+	}
+	existing, err := rows.Columns()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(existing))
+	for _, column := range existing {
+		known[strings.ToLower(column)] = true
+	}
+	return known, nil
+}
+
+// Write the rows within a single transaction
+// In MergeMode the rows with the same key get deleted before each row is inserted
+func (s *DatabaseSink) Write(ctx context.Context, rows []Issue) (int, error) {
+	if len(rows) < 1 {
+		return 0, nil
+	}
+
+	var columns []string
+	for _, field := range s.fields {
+		columns = append(columns, field.Name)
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, s.insertQuery(s.Table, columns))
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var remove *sql.Stmt
+	if s.Mode == MergeMode {
+		remove, err = tx.PrepareContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE %s = %s", s.quote(s.Table), s.quote(s.Key), s.placeholder(1)))
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+		defer remove.Close()
+	}
+
+	for _, row := range rows {
+		values, _, err := row.Save()
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+
+		if remove != nil {
+			if _, err := remove.ExecContext(ctx, values[s.Key]); err != nil {
+				tx.Rollback()
+				return 0, err
+			}
+		}
+
+		args := make([]interface{}, len(s.fields))
+		for i, field := range s.fields {
+			if args[i], err = sqlValue(field, values[field.Name]); err != nil {
+				tx.Rollback()
+				return 0, err
+			}
+		}
+
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(rows), nil
+}
+
+// Close the database
+func (s *DatabaseSink) Close() error {
+	return s.DB.Close()
+}
+
+// Empty reports whether the table contains no rows
+func (s *DatabaseSink) Empty(ctx context.Context) (bool, error) {
+	var rows int
+	if err := s.DB.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM %s", s.quote(s.Table))).Scan(&rows); err != nil {
+		return false, err
+	}
+	return rows == 0, nil
+}
+
+// maxDeleteKeys is the amount of keys deleted per statement, as databases limit the amount of query arguments
+const maxDeleteKeys = 500
+
+// Keys of the issues stored in the table, which have not been deleted yet
+func (s *DatabaseSink) Keys(ctx context.Context) ([]string, error) {
+	if len(s.Key) < 1 {
+		return nil, errors.New("reconciling requires a key column, please configure BIGQUERY_KEY")
+	}
+	if s.Mode == SnapshotMode {
+		return nil, errors.New("reconciling is not supported in snapshot mode, deleted issues are missing from the next snapshot")
+	}
+
+	filter := ""
+	if s.Mode != MergeMode {
+		known, err := s.columns(ctx, s.Table)
+		if err != nil {
+			return nil, err
+		}
+		if known[deletedColumn] {
+			filter = fmt.Sprintf(" AND %s IS NULL", s.quote(deletedColumn))
+		}
+	}
+
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(
+		"SELECT DISTINCT CAST(%s AS TEXT) FROM %s WHERE %s IS NOT NULL%s",
+		s.quote(s.Key), s.quote(s.Table), s.quote(s.Key), filter,
+	))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// Delete the issues with the provided keys and return the amount of issues deleted
+// In MergeMode their rows get removed, otherwise all of their rows are marked by setting the deletedColumn to at
+func (s *DatabaseSink) Delete(ctx context.Context, keys []string, at time.Time) (int, error) {
+	if len(keys) < 1 {
+		return 0, nil
+	}
+
+	if s.Mode != MergeMode {
+		known, err := s.columns(ctx, s.Table)
+		if err != nil {
+			return 0, err
+		}
+		if !known[deletedColumn] {
+			if _, err := s.DB.ExecContext(ctx, fmt.Sprintf(
+				"ALTER TABLE %s ADD COLUMN %s %s", s.quote(s.Table), s.quote(deletedColumn), sqlType(FieldSchema{Type: "TIMESTAMP"}),
+			)); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	for start := 0; start < len(keys); start += maxDeleteKeys {
+		end := start + maxDeleteKeys
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		if _, err := tx.ExecContext(ctx, s.deleteQuery(end-start), s.deleteArgs(keys[start:end], at)...); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return len(keys), nil
+}
+
+// deleteQuery for n keys, which sets the deletedColumn to the first argument outside of MergeMode
+func (s *DatabaseSink) deleteQuery(n int) string {
+	offset := 1
+	if s.Mode == MergeMode {
+		offset = 0
+	}
+
+	placeholders := make([]string, n)
+	for i := range placeholders {
+		placeholders[i] = s.placeholder(offset + i + 1)
+	}
+	filter := fmt.Sprintf("CAST(%s AS TEXT) IN (%s)", s.quote(s.Key), strings.Join(placeholders, ", "))
+
+	if s.Mode == MergeMode {
+		return fmt.Sprintf("DELETE FROM %s WHERE %s", s.quote(s.Table), filter)
+	}
+	return fmt.Sprintf(
+		"UPDATE %s SET %s = %s WHERE %s IS NULL AND %s",
+		s.quote(s.Table), s.quote(deletedColumn), s.placeholder(1), s.quote(deletedColumn), filter,
+	)
+}
+
+// deleteArgs of the deleteQuery for keys
+func (s *DatabaseSink) deleteArgs(keys []string, at time.Time) []interface{} {
+	var args []interface{}
+	if s.Mode != MergeMode {
+		args = append(args, at)
+	}
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	return args
+}
+
+// RecordExecution in the executions table
+func (s *DatabaseSink) RecordExecution(ctx context.Context, exec Execution) error {
+	var columns []string
+	for _, field := range executionSchema {
+		columns = append(columns, field.Name)
+	}
+
+	_, err := s.DB.ExecContext(ctx, s.insertQuery(s.Table+"_executions", columns),
+		exec.Timestamp, exec.Finished, exec.Duration, exec.Status, exec.Error,
+		exec.Fetched, exec.Inserted, exec.Rejected, exec.JQL, exec.SchemaHash, exec.Version,
+		exec.Sync, exec.Deleted, nullTimestamp(exec.Checkpoint), exec.Position,
+	)
+	return err
+}
+
+// LastExecution of sync that succeeded from the executions table
+func (s *DatabaseSink) LastExecution(ctx context.Context, sync string) (Execution, error) {
+	var exec Execution
+	var checkpoint *time.Time
+	var position sql.NullString
+	err := s.DB.QueryRowContext(ctx, fmt.Sprintf(
+		"SELECT %s, %s, %s FROM %s WHERE %s = %s AND %s ORDER BY %s DESC LIMIT 1",
+		s.quote("timestamp"), s.quote("checkpoint"), s.quote("position"), s.quote(s.Table+"_executions"), s.quote("status"), s.placeholder(1), s.syncFilter(sync, 2), s.quote("timestamp"),
+	), ExecutionSucceeded, sync).Scan(&exec.Timestamp, &checkpoint, &position)
+	if err == sql.ErrNoRows {
+		return Execution{}, nil
+	}
+	if err != nil {
+		return Execution{}, err
+	}
+
+	exec.Timestamp = exec.Timestamp.In(time.UTC)
+	exec.Position = position.String
+	if checkpoint != nil {
+		exec.Checkpoint = bigquery.NullTimestamp{Timestamp: checkpoint.In(time.UTC), Valid: true}
+	}
+	return exec, nil
+}
+
+// RecentExecutions of sync from the executions table
+func (s *DatabaseSink) RecentExecutions(ctx context.Context, sync string, limit int) ([]Execution, error) {
+	rows, err := s.DB.QueryContext(ctx, fmt.Sprintf(
+		"SELECT %s, %s, %s, %s, %s FROM %s WHERE %s ORDER BY %s DESC LIMIT %d",
+		s.quote("timestamp"), s.quote("status"), s.quote("fetched"), s.quote("inserted"), s.quote("rejected"),
+		s.quote(s.Table+"_executions"), s.syncFilter(sync, 1), s.quote("timestamp"), limit,
+	), sync)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var executions []Execution
+	for rows.Next() {
+		var exec Execution
+		var status sql.NullString
+		if err := rows.Scan(&exec.Timestamp, &status, &exec.Fetched, &exec.Inserted, &exec.Rejected); err != nil {
+			return nil, err
+		}
+		exec.Timestamp = exec.Timestamp.In(time.UTC)
+		exec.Status = status.String
+		executions = append(executions, exec)
+	}
+
+	return executions, rows.Err()
+}
+
+// sqlValue of the field as database value, as drivers only support scalar values
+// Repeated fields and lists or objects extracted into other fields are stored as JSON encoded text
+func sqlValue(field FieldSchema, value interface{}) (interface{}, error) {
+	if field.Repeated {
+		return formatValue(value)
+	}
+
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		if _, ok := value.([]byte); ok {
+			return value, nil
+		}
+		return formatValue(value)
+	}
+
+	return value, nil
+}
+
+// syncFilter of the executions of sync, which is the n-th query argument
+// Executions of IssuesSync may have been recorded without sync or with an empty one, see Execution.of
+func (s *DatabaseSink) syncFilter(sync string, n int) string {
+	if sync == IssuesSync {
+		return fmt.Sprintf("COALESCE(%s, '') IN ('', %s)", s.quote("sync"), s.placeholder(n))
+	}
+	return fmt.Sprintf("%s = %s", s.quote("sync"), s.placeholder(n))
+}
+
+// nullTimestamp as database value, NULL if it is not valid
+func nullTimestamp(value bigquery.NullTimestamp) interface{} {
+	if !value.Valid {
+		return nil
+	}
+	return value.Timestamp
+}
+
+// insertQuery for all columns of table
+func (s *DatabaseSink) insertQuery(table string, columns []string) string {
+	quoted := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = s.quote(column)
+		placeholders[i] = s.placeholder(i + 1)
+	}
+
+	return fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s)",
+		s.quote(table), strings.Join(quoted, ", "), strings.Join(placeholders, ", "),
+	)
+}
+
+// placeholder for the n-th query argument, as postgres does not support `?`
+func (s *DatabaseSink) placeholder(n int) string {
+	if s.Driver == "postgres" {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+// quote an identifier
+func (s *DatabaseSink) quote(identifier string) string {
+	return fmt.Sprintf(`"%s"`, strings.Replace(identifier, `"`, `""`, -1))
+}
+
+// sqlType of the field, repeated fields are stored as text
+func sqlType(field FieldSchema) string {
+	if field.Repeated {
+		return "TEXT"
+	}
+
+	switch strings.ToUpper(field.Type) {
+	case "INTEGER":
+		return "BIGINT"
+	case "FLOAT":
+		return "DOUBLE PRECISION"
+	case "BOOLEAN":
+		return "BOOLEAN"
+	case "TIMESTAMP":
+		return "TIMESTAMP"
+	case "DATE":
+		return "DATE"
+	}
+
+	return "TEXT"
+}
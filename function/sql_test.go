@@ -0,0 +1,202 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	// register the sqlite3 driver for the tests, like the command line tool does
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// testDatabase returns the data source name of a sqlite database inside a temporary directory, which is removed by the returned func
+func testDatabase(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return filepath.Join(dir, "jira.db"), func() { os.RemoveAll(dir) }
+}
+
+// newTestDatabaseSink writing into the sqlite database dsn
+func newTestDatabaseSink(t *testing.T, dsn string) *DatabaseSink {
+	sink, err := NewDatabaseSink("sqlite3", dsn, "issues")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sink
+}
+
+func TestDatabaseSinkEncodesListsAndObjects(t *testing.T) {
+	dsn, cleanup := testDatabase(t)
+	defer cleanup()
+	sink := newTestDatabaseSink(t, dsn)
+	defer sink.DB.Close()
+
+	ctx := context.Background()
+	if err := sink.Prepare(ctx, []FieldSchema{
+		FieldSchema{Name: "issue", Type: "string", Path: "key", Required: true},
+		FieldSchema{Name: "labels", Type: "string", Path: "fields.labels", Repeated: true},
+		FieldSchema{Name: "status", Type: "string", Path: "fields.status"},
+		FieldSchema{Name: "versions", Type: "string", Path: "fields.fixVersions"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sink.Write(ctx, []Issue{
+		Issue{"issue": "ABC-1", "labels": []interface{}{"a", "b"}, "status": map[string]interface{}{"name": "Done"}, "versions": []interface{}{"1.0"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var issue, labels, status, versions string
+	if err := sink.DB.QueryRowContext(ctx, `SELECT "issue", "labels", "status", "versions" FROM "issues"`).Scan(&issue, &labels, &status, &versions); err != nil {
+		t.Fatal(err)
+	}
+	if got, expect := []string{issue, labels, status, versions}, []string{"ABC-1", `["a","b"]`, `{"name":"Done"}`, `["1.0"]`}; !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got invalid row: %v\nexpected: %v", got, expect)
+	}
+}
+
+func TestDatabaseSinkCheckpointOfIssuesRuns(t *testing.T) {
+	jira := httptest.NewServer(pagedJira(1))
+	defer jira.Close()
+
+	dsn, cleanup := testDatabase(t)
+	defer cleanup()
+	sink := newTestDatabaseSink(t, dsn)
+	defer sink.DB.Close()
+
+	ctx := context.Background()
+	fields := []FieldSchema{FieldSchema{Name: "issue", Type: "string", Path: "key"}}
+	if err := sink.Prepare(ctx, fields); err != nil {
+		t.Fatal(err)
+	}
+
+	// runs recorded before syncs were introduced have no sync, either NULL or empty
+	legacy := time.Date(2019, 11, 12, 10, 0, 0, 0, time.UTC)
+	for _, exec := range []Execution{
+		Execution{Timestamp: legacy.Add(-time.Hour), Status: ExecutionSucceeded},
+		Execution{Timestamp: legacy, Status: ExecutionSucceeded},
+		Execution{Timestamp: legacy.Add(time.Hour), Status: ExecutionSucceeded, Sync: CommentsSync},
+	} {
+		if err := sink.RecordExecution(ctx, exec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := sink.DB.ExecContext(ctx, `UPDATE "issues_executions" SET "sync" = NULL WHERE "timestamp" < ?`, legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	checkpoints := ExecutionCheckpoints{Log: sink, Sync: IssuesSync}
+	checkpoint, err := checkpoints.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !checkpoint.Timestamp.Equal(legacy) {
+		t.Fatalf("got invalid checkpoint: %v\nexpected: %v", checkpoint.Timestamp, legacy)
+	}
+
+	dir := filepath.Dir(dsn)
+	auth, err := json.Marshal(JiraAuth{URL: jira.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := Environment{
+		JiraAuthSecret: string(auth),
+		JiraProject:    "ABC",
+		Sink:           SQLSink,
+		SinkDriver:     "sqlite3",
+		SinkPath:       dsn,
+		SchemaPath:     filepath.Join(dir, "schema.json"),
+	}
+	if err := ioutil.WriteFile(env.SchemaPath, []byte(`[{"name":"issue","type":"STRING","path":"key"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().UTC()
+	if err := InsertIssues(ctx, env, RunOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the run is recorded as issues run and becomes the checkpoint of the next one
+	var sync string
+	if err := sink.DB.QueryRowContext(ctx, `SELECT "sync" FROM "issues_executions" ORDER BY "timestamp" DESC LIMIT 1`).Scan(&sync); err != nil {
+		t.Fatal(err)
+	}
+	if sync != IssuesSync {
+		t.Fatalf("got invalid sync: %v\nexpected: %v", sync, IssuesSync)
+	}
+
+	checkpoint, err = checkpoints.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint.Timestamp.Before(start.Truncate(time.Second)) {
+		t.Fatalf("got invalid checkpoint: %v\nexpected: %v", checkpoint.Timestamp, "the start of the run")
+	}
+}
+
+func TestDatabaseSinkDeletesKeys(t *testing.T) {
+	for _, c := range []struct {
+		mode string
+		rows int
+	}{
+		// deleted issues keep their rows outside of merge mode, which get marked as deleted
+		{AppendMode, 4},
+		{MergeMode, 1},
+	} {
+		dsn, cleanup := testDatabase(t)
+		defer cleanup()
+		sink := newTestDatabaseSink(t, dsn)
+		defer sink.DB.Close()
+		sink.Mode, sink.Key = c.mode, "issue"
+
+		ctx := context.Background()
+		if err := sink.Prepare(ctx, []FieldSchema{
+			FieldSchema{Name: "issue", Type: "STRING", Path: "key", Required: true},
+			FieldSchema{Name: "summary", Type: "STRING", Path: "fields.summary"},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := sink.Write(ctx, []Issue{
+			Issue{"issue": "ABC-1", "summary": "old"},
+			Issue{"issue": "ABC-1", "summary": "new"},
+			Issue{"issue": "ABC-2"},
+			Issue{"issue": "ABC-3"},
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		deleted, err := sink.Delete(ctx, []string{"ABC-1", "ABC-3"}, time.Now().UTC())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted != 2 {
+			t.Fatalf("got invalid amount of deleted issues in %s mode: %v\nexpected: %v", c.mode, deleted, 2)
+		}
+
+		keys, err := sink.Keys(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := []string{"ABC-2"}; !reflect.DeepEqual(keys, expect) {
+			t.Fatalf("got invalid keys in %s mode: %v\nexpected: %v", c.mode, keys, expect)
+		}
+
+		var rows int
+		if err := sink.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM "issues"`).Scan(&rows); err != nil {
+			t.Fatal(err)
+		}
+		if rows != c.rows {
+			t.Fatalf("got invalid amount of rows in %s mode: %v\nexpected: %v", c.mode, rows, c.rows)
+		}
+	}
+}
@@ -3,32 +3,60 @@ package function
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"os"
 
 	"cloud.google.com/go/storage"
 	"github.com/seibert-media/golibs/log"
-	"go.uber.org/zap"
+	"google.golang.org/api/option"
 )
 
-// GetSchema from the projects bucket and path
-func GetSchema(ctx context.Context, bucket, path string) ([]FieldSchema, error) {
-
-	client, err := storage.NewClient(ctx)
-	if err != nil {
-		return nil, err
+// NewStorageClient for Google Cloud Storage
+// If STORAGE_EMULATOR_HOST is set, all requests are sent to the unauthenticated emulator running there
+func NewStorageClient(ctx context.Context) (*storage.Client, error) {
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); len(host) > 0 {
+		return storage.NewClient(ctx,
+			option.WithEndpoint(fmt.Sprintf("http://%s/storage/v1/", host)),
+			option.WithoutAuthentication(),
+		)
 	}
-	obj := client.Bucket(bucket).Object(path)
 
-	reader, err := obj.NewReader(ctx)
-	if err != nil {
-		return nil, err
+	return storage.NewClient(ctx)
+}
+
+// GetSchema from the projects bucket and path
+// If no bucket is provided, the schema is read from the local file at path
+func GetSchema(ctx context.Context, bucket, path string) ([]FieldSchema, error) {
+	var reader io.ReadCloser
+
+	if len(bucket) < 1 {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		reader = file
+	} else {
+		client, err := NewStorageClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer client.Close()
+		obj := client.Bucket(bucket).Object(path)
+
+		reader, err = obj.NewReader(ctx)
+		if err != nil {
+			return nil, err
+		}
 	}
+	defer reader.Close()
 
 	var fields []FieldSchema
 
 	log.From(ctx).Debug("parsing schema")
 	if err := json.NewDecoder(reader).Decode(&fields); err != nil {
-		log.From(ctx).Fatal("parsing schema", zap.Error(err))
+		return nil, fmt.Errorf("parsing schema: %v", err)
 	}
 
 	return fields, nil
-} 
+}
@@ -0,0 +1,27 @@
+package function
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetSchemaReturnsParseErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "schema.json")
+	if err := ioutil.WriteFile(path, []byte(`[{"name":"issue",`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GetSchema(context.Background(), "", path); err == nil || !strings.HasPrefix(err.Error(), "parsing schema") {
+		t.Fatalf("got invalid error: %v\nexpected: %v", err, "parsing schema")
+	}
+}
@@ -0,0 +1,67 @@
+package function
+
+import (
+	"context"
+	"time"
+)
+
+// Summary of a run, adding up the executions it recorded
+type Summary struct {
+	Sync     string  `json:"sync"`
+	Status   string  `json:"status"`
+	Error    string  `json:"error,omitempty"`
+	Fetched  int     `json:"fetched"`
+	Inserted int     `json:"inserted"`
+	Rejected int     `json:"rejected"`
+	Deleted  int     `json:"deleted"`
+	Duration float64 `json:"duration"`
+	// Executions recorded by the run, backfills record one per window
+	Executions []Execution `json:"executions"`
+}
+
+// executionsKey of the executions collected in a context
+type executionsKey struct{}
+
+// RunSummary runs the sync selected by opts like Run and summarizes the executions it recorded
+// The summary is returned for failed runs as well, containing the run's error
+// Afterwards the environment's webhook gets notified about the run, except in a dry run
+func RunSummary(ctx context.Context, env Environment, opts RunOptions) (Summary, error) {
+	start := time.Now()
+
+	executions := []Execution{}
+	err := Run(context.WithValue(ctx, executionsKey{}, &executions), env, opts)
+
+	summary := Summary{
+		Sync:       opts.Sync,
+		Status:     ExecutionSucceeded,
+		Duration:   time.Since(start).Seconds(),
+		Executions: executions,
+	}
+	if len(summary.Sync) < 1 {
+		summary.Sync = IssuesSync
+	}
+	if err != nil {
+		summary.Status = ExecutionFailed
+		summary.Error = err.Error()
+	}
+
+	for _, exec := range executions {
+		summary.Fetched += exec.Fetched
+		summary.Inserted += exec.Inserted
+		summary.Rejected += exec.Rejected
+		summary.Deleted += exec.Deleted
+	}
+
+	if !opts.DryRun {
+		Notify(ctx, env, summary)
+	}
+
+	return summary, err
+}
+
+// collectExecution into the executions of ctx, if it is summarized by RunSummary
+func collectExecution(ctx context.Context, exec Execution) {
+	if executions, ok := ctx.Value(executionsKey{}).(*[]Execution); ok {
+		*executions = append(*executions, exec)
+	}
+}
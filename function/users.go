@@ -0,0 +1,229 @@
+package function
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	// KeepUsers stores users as returned by Jira, this is the default
+	KeepUsers = "keep"
+	// HashUsers replaces the ids, names, display names and emails of users by their salted hash
+	HashUsers = "hash"
+	// DropUsers replaces the ids of users by their salted hash and removes their names, display names and emails
+	DropUsers = "drop"
+)
+
+// userSchema of the `<table>_users` table
+var userSchema = []FieldSchema{
+	FieldSchema{Name: "id", Type: "STRING", Path: "id", Required: true},
+	FieldSchema{Name: "name", Type: "STRING", Path: "name"},
+	FieldSchema{Name: "displayName", Type: "STRING", Path: "displayName"},
+	FieldSchema{Name: "email", Type: "STRING", Path: "email"},
+	FieldSchema{Name: "active", Type: "BOOLEAN", Path: "active"},
+	FieldSchema{Name: "timeZone", Type: "STRING", Path: "timeZone"},
+}
+
+var (
+	// userIDs identify a user in Jira, accountId in Jira Cloud and key in Jira Server
+	userIDs = []string{"accountId", "key"}
+	// userIdentities allow to identify the person behind a user
+	userIdentities = []string{"name", "displayName", "emailAddress"}
+	// userFields are the issue fields whose changelog items refer to users
+	userFields = map[string]bool{"assignee": true, "reporter": true, "creator": true}
+)
+
+// UserPolicy pseudonymizes the users referenced by Jira objects
+type UserPolicy struct {
+	// Mode is either KeepUsers, HashUsers or DropUsers
+	Mode string
+	// Salt keys the hashes, so they can not be reversed by hashing known users
+	Salt string
+}
+
+// userPolicy configured by the environment
+func (e Environment) userPolicy() UserPolicy {
+	return UserPolicy{Mode: e.UserPolicy, Salt: e.UserSalt}
+}
+
+// Apply the policy to all users within the object, which gets modified in place
+// Users are recognized by their `self` link, which gets removed together with their avatars as both contain the user's name
+// Changelog items of user fields get pseudonymized as well
+func (p UserPolicy) Apply(object interface{}) {
+	if p.Mode != HashUsers && p.Mode != DropUsers {
+		return
+	}
+
+	switch v := object.(type) {
+	case Issue:
+		p.Apply(map[string]interface{}(v))
+	case []Issue:
+		for _, element := range v {
+			p.Apply(element)
+		}
+	case []interface{}:
+		for _, element := range v {
+			p.Apply(element)
+		}
+	case map[string]interface{}:
+		if isUser(v) {
+			p.pseudonymize(v, userIDs, userIdentities)
+			delete(v, "self")
+			delete(v, "avatarUrls")
+			return
+		}
+		if v["fieldtype"] == "jira" && userFields[fmt.Sprint(v["field"])] {
+			p.pseudonymize(v, []string{"from", "to"}, []string{"fromString", "toString"})
+			return
+		}
+		for _, value := range v {
+			p.Apply(value)
+		}
+	}
+}
+
+// pseudonymize the values of object, ids get hashed and identities get hashed or removed depending on the Mode
+func (p UserPolicy) pseudonymize(object map[string]interface{}, ids, identities []string) {
+	if p.Mode != HashUsers && p.Mode != DropUsers {
+		return
+	}
+
+	for _, key := range ids {
+		if value, ok := object[key].(string); ok && len(value) > 0 {
+			object[key] = p.hash(value)
+		}
+	}
+
+	for _, key := range identities {
+		value, ok := object[key].(string)
+		if !ok || len(value) < 1 {
+			continue
+		}
+		if p.Mode == DropUsers {
+			delete(object, key)
+			continue
+		}
+		object[key] = p.hash(value)
+	}
+}
+
+// hash the value using HMAC-SHA256 keyed with the Salt
+func (p UserPolicy) hash(value string) string {
+	return keyedHash([]byte(p.Salt), value)
+}
+
+// isUser reports whether the object is a user, based on it's `self` link
+func isUser(object map[string]interface{}) bool {
+	self, _ := object["self"].(string)
+	return strings.Contains(self, "/rest/api/2/user?")
+}
+
+// CollectUsers referenced by the objects as rows of the users table, each user is only contained once
+// References of the same user may contain different attributes, e.g. only some contain the email, so they get combined
+// The users get collected before applying the policy, which has to be applied to the resulting rows separately
+func CollectUsers(objects []Issue) []Issue {
+	seen := make(map[string]Issue)
+	var users []Issue
+
+	var collect func(object interface{})
+	collect = func(object interface{}) {
+		switch v := object.(type) {
+		case Issue:
+			collect(map[string]interface{}(v))
+		case []interface{}:
+			for _, element := range v {
+				collect(element)
+			}
+		case map[string]interface{}:
+			if !isUser(v) {
+				for _, value := range v {
+					collect(value)
+				}
+				return
+			}
+
+			id := userID(v)
+			if len(id) < 1 {
+				return
+			}
+
+			user, ok := seen[id]
+			if !ok {
+				user = Issue{"id": id}
+				seen[id] = user
+				users = append(users, user)
+			}
+
+			for column, key := range map[string]string{
+				"name": "name", "displayName": "displayName", "email": "emailAddress", "active": "active", "timeZone": "timeZone",
+			} {
+				if user[column] == nil {
+					user[column] = v[key]
+				}
+			}
+		}
+	}
+
+	for _, object := range objects {
+		collect(object)
+	}
+
+	return users
+}
+
+// userID of the user, preferring the accountId of Jira Cloud over the key and name of Jira Server
+func userID(user map[string]interface{}) string {
+	for _, key := range []string{"accountId", "key", "name"} {
+		if value, ok := user[key].(string); ok && len(value) > 0 {
+			return value
+		}
+	}
+	return ""
+}
+
+// writeUsers collected by CollectUsers into the `<table>_users` table, after applying the environment's policy
+func writeUsers(ctx context.Context, env Environment, opts RunOptions, users []Issue) (int, error) {
+	policy := env.userPolicy()
+	for _, user := range users {
+		policy.pseudonymize(user, []string{"id"}, []string{"name", "displayName", "email"})
+	}
+
+	sink, err := openTable(ctx, env.dimension("users", "id"), opts)
+	if err != nil {
+		return 0, err
+	}
+	defer sink.Close()
+
+	if err := sink.Prepare(ctx, userSchema); err != nil {
+		return 0, err
+	}
+
+	rows := make([]Issue, len(users))
+	for i, user := range users {
+		if rows[i], err = FieldExtractor(userSchema).extractRow(user); err != nil {
+			return 0, err
+		}
+	}
+
+	return sink.Write(ctx, rows)
+}
+
+// LoadUserSalt from the environment, which is empty if no salt is configured
+// If no KMS resource is configured, the salt is expected in plain text, like for LoadPrivacyKey
+func LoadUserSalt(ctx context.Context, env Environment) (string, error) {
+	if len(env.UserSalt) < 1 || len(env.UserSaltResource) < 1 {
+		return env.UserSalt, nil
+	}
+
+	salt, err := decrypt(ctx, env.UserSaltResource, env.UserSalt)
+	if err != nil {
+		return "", err
+	}
+	return string(salt), nil
+}
+
+// EncodeUserSalt for the provided resource
+func EncodeUserSalt(ctx context.Context, resource, salt string) (string, error) {
+	return encrypt(ctx, resource, []byte(salt))
+}
@@ -0,0 +1,110 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const userIssue = `{
+	"key": "ABC-1",
+	"self": "https://jira.example.com/rest/api/2/issue/10000",
+	"fields": {
+		"assignee": {"self": "https://jira.example.com/rest/api/2/user?username=jdoe", "key": "jdoe", "name": "jdoe", "displayName": "Jane Doe", "emailAddress": "jane@example.com", "active": true, "avatarUrls": {"48x48": "https://jira.example.com/secure/useravatar?ownerId=jdoe"}},
+		"reporter": {"self": "https://jira.example.com/rest/api/2/user?username=jdoe", "key": "jdoe", "name": "jdoe", "displayName": "Jane Doe"},
+		"summary": "Jane Doe was here"
+	},
+	"changelog": {"histories": [{
+		"author": {"self": "https://jira.example.com/rest/api/2/user?username=admin", "key": "admin", "name": "admin", "displayName": "Admin"},
+		"items": [{"field": "assignee", "fieldtype": "jira", "from": null, "fromString": null, "to": "jdoe", "toString": "Jane Doe"}]
+	}]}
+}`
+
+func parseUserIssue(t *testing.T) Issue {
+	var issue Issue
+	if err := json.Unmarshal([]byte(userIssue), &issue); err != nil {
+		t.Fatal(err)
+	}
+	return issue
+}
+
+func TestUserPolicyHash(t *testing.T) {
+	policy := UserPolicy{Mode: HashUsers, Salt: "salt"}
+	issue := parseUserIssue(t)
+	policy.Apply([]Issue{issue})
+
+	assignee := issue["fields"].(map[string]interface{})["assignee"].(map[string]interface{})
+	expect := map[string]interface{}{
+		"key":          policy.hash("jdoe"),
+		"name":         policy.hash("jdoe"),
+		"displayName":  policy.hash("Jane Doe"),
+		"emailAddress": policy.hash("jane@example.com"),
+		"active":       true,
+	}
+	if !reflect.DeepEqual(assignee, expect) {
+		t.Fatalf("got invalid assignee: %v\nexpected: %v", assignee, expect)
+	}
+
+	item := issue["changelog"].(map[string]interface{})["histories"].([]interface{})[0].(map[string]interface{})["items"].([]interface{})[0].(map[string]interface{})
+	if item["to"] != policy.hash("jdoe") || item["toString"] != policy.hash("Jane Doe") || item["from"] != nil {
+		t.Fatalf("got invalid changelog item: %v\nexpected: %v", item, "hashed to and toString")
+	}
+
+	if issue["self"] != "https://jira.example.com/rest/api/2/issue/10000" {
+		t.Fatalf("got invalid issue self: %v\nexpected: %v", issue["self"], "unchanged")
+	}
+}
+
+func TestUserPolicyDrop(t *testing.T) {
+	policy := UserPolicy{Mode: DropUsers, Salt: "salt"}
+	issue := parseUserIssue(t)
+	policy.Apply(issue)
+
+	reporter := issue["fields"].(map[string]interface{})["reporter"].(map[string]interface{})
+	expect := map[string]interface{}{"key": policy.hash("jdoe")}
+	if !reflect.DeepEqual(reporter, expect) {
+		t.Fatalf("got invalid reporter: %v\nexpected: %v", reporter, expect)
+	}
+}
+
+func TestUserPolicyRequiresSaltWithoutArchive(t *testing.T) {
+	env := Environment{JiraAuthSecret: "secret", JiraProject: "ABC", SchemaPath: "schema.json", BigQueryProject: "p", BigQueryDataset: "d", BigQueryTable: "t"}
+	for _, c := range []struct {
+		policy  string
+		salt    string
+		archive string
+		valid   bool
+	}{
+		{KeepUsers, "", "file://archive", true},
+		{HashUsers, "salt", "", true},
+		{HashUsers, "", "", false},
+		{HashUsers, "salt", "file://archive", false},
+		{DropUsers, "salt", "gs://bucket/archive", false},
+	} {
+		env.UserPolicy, env.UserSalt, env.Archive = c.policy, c.salt, c.archive
+		if err := env.Validate(); (err == nil) != c.valid {
+			t.Fatalf("got invalid error for %v with salt %q and archive %q: %v\nexpected valid: %v", c.policy, c.salt, c.archive, err, c.valid)
+		}
+	}
+}
+
+func TestLoadUserSaltWithoutResource(t *testing.T) {
+	salt, err := LoadUserSalt(context.Background(), Environment{UserSalt: "salt"})
+	if err != nil || salt != "salt" {
+		t.Fatalf("got invalid salt: %q, %v\nexpected: %v", salt, err, "salt")
+	}
+}
+
+func TestCollectUsers(t *testing.T) {
+	users := CollectUsers([]Issue{parseUserIssue(t)})
+	if len(users) != 2 {
+		t.Fatalf("got invalid amount of users: %v\nexpected: %v", len(users), 2)
+	}
+
+	for _, user := range users {
+		if user["id"] == "jdoe" && user["email"] != "jane@example.com" {
+			t.Fatalf("got invalid user: %v\nexpected: %v", user, "jane@example.com")
+		}
+	}
+}
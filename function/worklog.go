@@ -0,0 +1,245 @@
+package function
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/seibert-media/golibs/log"
+	"go.uber.org/zap"
+)
+
+// worklogSchema of the `<table>_worklogs` table
+// The issue's key is not part of a worklog, it gets added as issueKey before extraction
+var worklogSchema = []FieldSchema{
+	FieldSchema{Name: "id", Type: "STRING", Path: "id", Required: true},
+	FieldSchema{Name: "issue", Type: "STRING", Path: "issueKey", Required: true},
+	FieldSchema{Name: "author", Type: "STRING", Path: "author.displayName"},
+	FieldSchema{Name: "started", Type: "TIMESTAMP", Path: "started"},
+	FieldSchema{Name: "timeSpentSeconds", Type: "INTEGER", Path: "timeSpentSeconds"},
+	FieldSchema{Name: "comment", Type: "STRING", Path: "comment"},
+	FieldSchema{Name: "updated", Type: "TIMESTAMP", Path: "updated"},
+}
+
+// maxWorklogIDs is the amount of worklogs jira returns per call to /worklog/list
+const maxWorklogIDs = 1000
+
+// SyncWorklogs writes all worklogs of the project's issues changed since the last run into the `<table>_worklogs` table
+// Worklogs deleted since the last run get removed from the table, if the sink supports it
+// In a dry run, the rows are printed to stdout instead and nothing gets created, written or recorded
+func SyncWorklogs(ctx context.Context, env Environment, opts RunOptions) (err error) {
+	exec := Execution{Timestamp: time.Now().UTC(), Version: env.Version, Sync: WorklogsSync, SchemaHash: SchemaHash(worklogSchema)}
+	env = env.dimension("worklogs", "id")
+
+	sink, checkpoints, err := openSink(ctx, env, opts, WorklogsSync)
+	if err != nil {
+		return err
+	}
+	defer sink.Close()
+	defer checkpoints.Close()
+	defer recordExecution(ctx, sink, &exec, &err)
+
+	if err := sink.Prepare(ctx, worklogSchema); err != nil {
+		log.From(ctx).Error("preparing sink", zap.Error(err))
+		return err
+	}
+
+	log.From(ctx).Debug("loading checkpoint")
+	last, err := checkpoints.Load(ctx)
+	if err != nil {
+		log.From(ctx).Error("loading checkpoint", zap.Error(err))
+		return err
+	}
+
+	// give 2 minutes of buffer, as jira omits worklogs changed within the last minute
+	since := last.Timestamp
+	if !since.IsZero() {
+		since = since.Add(-2 * time.Minute)
+	}
+
+	log.From(ctx).Debug("creating jira client")
+	jira, err := NewJiraClient(ctx, env)
+	if err != nil {
+		log.From(ctx).Error("creating jira client", zap.Error(err))
+		return err
+	}
+
+	// the worklog api is not limited to a project, so worklogs of other projects get filtered by their issue
+	jql, err := jira.Query(time.Time{})
+	if err != nil {
+		log.From(ctx).Error("building query", zap.Error(err))
+		return err
+	}
+
+	log.From(ctx).Info("fetching issue keys", zap.String("jql", jql))
+	issues, err := jira.IssueKeys(ctx, jql)
+	if err != nil {
+		log.From(ctx).Error("fetching issue keys", zap.Error(err))
+		return err
+	}
+
+	keys := make(map[string]string, len(issues))
+	for _, issue := range issues {
+		keys[fmt.Sprint(issue["id"])] = fmt.Sprint(issue["key"])
+	}
+
+	log.From(ctx).Info("fetching worklogs", zap.Time("since", since))
+	updated, err := jira.WorklogChanges(ctx, "updated", since)
+	if err != nil {
+		log.From(ctx).Error("fetching updated worklogs", zap.Error(err))
+		return err
+	}
+
+	worklogs, err := jira.Worklogs(ctx, updated)
+	if err != nil {
+		log.From(ctx).Error("fetching worklogs", zap.Error(err))
+		return err
+	}
+
+	env.userPolicy().Apply(worklogs)
+
+	var rows []Issue
+	for _, worklog := range worklogs {
+		key, ok := keys[fmt.Sprint(worklog["issueId"])]
+		if !ok {
+			continue
+		}
+		worklog["issueKey"] = key
+
+		row, err := FieldExtractor(worklogSchema).extractRow(worklog)
+		if err != nil {
+			log.From(ctx).Error("converting worklog", zap.Error(err))
+			return err
+		}
+		row[insertIDKey] = fmt.Sprintf("%v-%v", worklog["id"], worklog["updated"])
+		rows = append(rows, row)
+	}
+	rows = uniqueRows(rows, "id")
+	exec.Fetched = len(rows)
+
+	log.From(ctx).Info("inserting")
+	exec.Inserted, err = sink.Write(ctx, rows)
+	exec.Rejected = rejectedRows(len(rows), exec.Inserted, err)
+	if err != nil {
+		log.From(ctx).Error("inserting", zap.Error(err))
+		return err
+	}
+
+	// on the first run there are no worklogs that could have been deleted from the table
+	if !since.IsZero() {
+		if err := deleteWorklogs(ctx, jira, sink, since, &exec); err != nil {
+			log.From(ctx).Error("deleting worklogs", zap.Error(err))
+			return err
+		}
+	}
+
+	log.From(ctx).Debug("saving checkpoint")
+	if err := checkpoints.Save(ctx, Checkpoint{Timestamp: exec.Timestamp}); err != nil {
+		log.From(ctx).Error("saving checkpoint", zap.Error(err))
+		return err
+	}
+
+	log.From(ctx).Info("inserted", zap.Int("worklogs", exec.Inserted), zap.Int("deleted", exec.Deleted))
+	return nil
+}
+
+// deleteWorklogs removes the worklogs deleted since the provided time from the sink
+func deleteWorklogs(ctx context.Context, jira JiraClient, sink Sink, since time.Time, exec *Execution) error {
+	reconciler, ok := sink.(Reconciler)
+	if !ok {
+		log.From(ctx).Info("sink does not support deleting rows, skipping deleted worklogs", zap.String("sink", fmt.Sprintf("%T", sink)))
+		return nil
+	}
+
+	log.From(ctx).Info("fetching deleted worklogs", zap.Time("since", since))
+	deleted, err := jira.WorklogChanges(ctx, "deleted", since)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]string, len(deleted))
+	for i, id := range deleted {
+		ids[i] = strconv.FormatInt(id, 10)
+	}
+
+	exec.Deleted, err = reconciler.Delete(ctx, ids, exec.Timestamp)
+	return err
+}
+
+type worklogChangesResponse struct {
+	Values []struct {
+		WorklogID int64 `json:"worklogId"`
+	} `json:"values"`
+	Until    int64 `json:"until"`
+	LastPage bool  `json:"lastPage"`
+}
+
+// WorklogChanges returns the ids of all worklogs `updated` or `deleted` since the provided time, depending on kind
+func (c JiraClient) WorklogChanges(ctx context.Context, kind string, since time.Time) ([]int64, error) {
+	var ids []int64
+	cursor := since.UnixNano() / int64(time.Millisecond)
+	if since.IsZero() {
+		cursor = 0
+	}
+
+	for {
+		log.From(ctx).Debug("reading worklog changes", zap.String("kind", kind), zap.Int64("since", cursor))
+
+		req, err := c.NewRequest("GET", fmt.Sprintf("rest/api/2/worklog/%s?since=%d", kind, cursor), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var body worklogChangesResponse
+		resp, err := c.Do(req, &body)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("reading %s worklogs: status %v", kind, resp.StatusCode)
+		}
+
+		for _, value := range body.Values {
+			ids = append(ids, value.WorklogID)
+		}
+
+		if body.LastPage || body.Until <= cursor {
+			return ids, nil
+		}
+		cursor = body.Until
+	}
+}
+
+// Worklogs with the provided ids, requested in batches of maxWorklogIDs
+func (c JiraClient) Worklogs(ctx context.Context, ids []int64) ([]Issue, error) {
+	worklogs := []Issue{}
+
+	for start := 0; start < len(ids); start += maxWorklogIDs {
+		end := start + maxWorklogIDs
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		log.From(ctx).Debug("reading worklogs", zap.Int("current", start), zap.Int("total", len(ids)))
+
+		req, err := c.NewRequest("POST", "rest/api/2/worklog/list", map[string][]int64{"ids": ids[start:end]})
+		if err != nil {
+			return nil, err
+		}
+
+		var body []Issue
+		resp, err := c.Do(req, &body)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("reading worklogs: status %v", resp.StatusCode)
+		}
+
+		worklogs = append(worklogs, body...)
+	}
+
+	return worklogs, nil
+}
@@ -0,0 +1,153 @@
+package function
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira"
+)
+
+func TestWorklogChangesFollowsPages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/api/2/worklog/updated" {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch r.URL.Query().Get("since") {
+		case "0":
+			w.Write([]byte(`{"values":[{"worklogId":1},{"worklogId":2}],"until":1000,"lastPage":false}`))
+		case "1000":
+			w.Write([]byte(`{"values":[{"worklogId":3}],"until":2000,"lastPage":true}`))
+		default:
+			http.Error(w, "unexpected since", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	client, err := jira.NewClient(nil, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := JiraClient{Client: client}.WorklogChanges(context.Background(), "updated", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []int64{1, 2, 3}
+	if !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got invalid worklog ids: %v\nexpected: %v", got, expect)
+	}
+}
+
+func TestWorklogsRequestsBatches(t *testing.T) {
+	var batches []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			IDs []int64 `json:"ids"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		batches = append(batches, len(body.IDs))
+
+		var worklogs []Issue
+		for _, id := range body.IDs {
+			worklogs = append(worklogs, Issue{"id": id})
+		}
+		json.NewEncoder(w).Encode(worklogs)
+	}))
+	defer server.Close()
+
+	client, err := jira.NewClient(nil, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make([]int64, maxWorklogIDs+1)
+	for i := range ids {
+		ids[i] = int64(i)
+	}
+
+	got, err := JiraClient{Client: client}.Worklogs(context.Background(), ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != len(ids) {
+		t.Fatalf("got invalid amount of worklogs: %v\nexpected: %v", len(got), len(ids))
+	}
+	if expect := []int{maxWorklogIDs, 1}; !reflect.DeepEqual(batches, expect) {
+		t.Fatalf("got invalid batches: %v\nexpected: %v", batches, expect)
+	}
+}
+
+func TestSyncWorklogsMergesIntoDatabase(t *testing.T) {
+	run := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rest/api/2/search":
+			w.Write([]byte(`{"startAt":0,"maxResults":1000,"total":1,"issues":[{"id":"10","key":"ABC-1"}]}`))
+		case "/rest/api/2/worklog/updated":
+			w.Write([]byte(`{"values":[{"worklogId":1},{"worklogId":2}],"until":1000,"lastPage":true}`))
+		case "/rest/api/2/worklog/deleted":
+			w.Write([]byte(`{"values":[],"until":1000,"lastPage":true}`))
+		case "/rest/api/2/worklog/list":
+			fmt.Fprintf(w, `[{"id":"1","issueId":"10","comment":"run %d"},{"id":"2","issueId":"10","comment":"run %d"}]`, run, run)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	dsn, cleanup := testDatabase(t)
+	defer cleanup()
+
+	env := Environment{
+		JiraAuthSecret: fmt.Sprintf(`{"url":%q}`, server.URL),
+		JiraProject:    "ABC",
+		Sink:           SQLSink,
+		SinkDriver:     "sqlite3",
+		SinkPath:       dsn,
+	}
+	ctx := context.Background()
+	for run = 1; run <= 2; run++ {
+		if err := SyncWorklogs(ctx, env, RunOptions{Sync: WorklogsSync}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sink := newTestDatabaseSink(t, dsn)
+	defer sink.DB.Close()
+
+	rows, err := sink.DB.QueryContext(ctx, `SELECT "id", "comment" FROM "issues_worklogs" ORDER BY "id"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var got []string
+	for rows.Next() {
+		var id, comment string
+		if err := rows.Scan(&id, &comment); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, id+": "+comment)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second run replaces the rows of the first one
+	if expect := []string{"1: run 2", "2: run 2"}; !reflect.DeepEqual(got, expect) {
+		t.Fatalf("got invalid worklogs: %v\nexpected: %v", got, expect)
+	}
+}
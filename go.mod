@@ -5,14 +5,20 @@ go 1.11
 require (
 	cloud.google.com/go v0.46.3
 	cloud.google.com/go/bigquery v1.3.0
+	cloud.google.com/go/firestore v1.0.0
 	cloud.google.com/go/storage v1.0.0
 	github.com/andygrunwald/go-jira v1.11.1
-	github.com/pkg/errors v0.8.0
+	github.com/lib/pq v1.2.0
+	github.com/mattn/go-sqlite3 v1.11.0
+	github.com/pkg/errors v0.8.1
+	github.com/prometheus/client_golang v1.2.1
 	github.com/seibert-media/golibs v1.0.3
 	github.com/stretchr/testify v1.4.0 // indirect
+	github.com/xitongsys/parquet-go v1.5.1
 	go.uber.org/zap v1.9.1
+	golang.org/x/net v0.0.0-20190628185345-da137c7871d7
 	golang.org/x/oauth2 v0.0.0-20190604053449-0f29369cfe45
 	google.golang.org/api v0.13.0
 	google.golang.org/genproto v0.0.0-20191108220845-16a3f7862a1a
-	google.golang.org/grpc v1.21.1
+	google.golang.org/grpc v1.22.0
 )